@@ -0,0 +1,358 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultHealthCheckInterval is how often a Cluster pings its replicas when ClusterOptions doesn't say
+const DefaultHealthCheckInterval = 5 * time.Second
+
+// ReplicaStrategy picks the replica serving a read
+type ReplicaStrategy int
+
+const (
+	// RoundRobin spreads reads evenly over the healthy replicas
+	RoundRobin ReplicaStrategy = iota
+
+	// LeastLatency sends reads to the healthy replica with the lowest ping latency
+	LeastLatency
+)
+
+// ClusterOptions configures how a Cluster routes reads and checks its replicas
+type ClusterOptions struct {
+	Strategy ReplicaStrategy
+
+	// HealthCheckInterval is how often replicas are pinged. 0 means DefaultHealthCheckInterval,
+	// a negative interval disables health checks.
+	HealthCheckInterval time.Duration
+
+	// MaxReplicaLag takes a replica out of rotation while its replication lags further behind the
+	// primary, see checkLag. 0 disables lag checks.
+	MaxReplicaLag time.Duration
+
+	// LagCheckInterval is how often the replication lag is measured. 0 means DefaultHealthCheckInterval.
+	LagCheckInterval time.Duration
+}
+
+// Cluster routes statements between a primary and its read replicas. Select, Queryx, QueryRowx and
+// NamedSelect go to a healthy replica, or to the primary when none is healthy. Writes and transactions
+// always go to the primary. Use WithPrimary to read from the primary, eg. right after a write.
+type Cluster struct {
+	primary  *DBX
+	replicas []*replica
+	strategy ReplicaStrategy
+
+	next    uint32
+	skipLog int32
+
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// replica is a read replica of a Cluster and its health
+type replica struct {
+	db   *DBX
+	name string
+
+	// down is set while the replica fails its health checks, lagging while it's too far behind the primary
+	down    int32
+	lagging int32
+
+	// latency is the moving average of the ping duration, in nanoseconds
+	latency int64
+}
+
+type primaryCtxKey struct{}
+
+var (
+	_ Querierx       = (*Cluster)(nil)
+	_ QuerierContext = (*Cluster)(nil)
+)
+
+// WithPrimary returns a context sending the reads of a Cluster to the primary
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryCtxKey{}, true)
+}
+
+func usePrimary(ctx context.Context) bool {
+	forced, _ := ctx.Value(primaryCtxKey{}).(bool)
+	return forced
+}
+
+// NewCluster connects to the primary and every replica with New, and starts checking the health of the replicas
+func NewCluster(primary *Config, replicas []*Config, opts ClusterOptions) (*Cluster, error) {
+	primaryDB, err := New(primary)
+	if err != nil {
+		return nil, err
+	}
+
+	replicaDBs := make([]*DBX, 0, len(replicas))
+	for _, cfg := range replicas {
+		db, err := New(cfg)
+		if err != nil {
+			primaryDB.Close()
+			for _, r := range replicaDBs {
+				r.Close()
+			}
+			return nil, err
+		}
+
+		replicaDBs = append(replicaDBs, db)
+	}
+
+	return NewClusterFromDBX(primaryDB, replicaDBs, opts), nil
+}
+
+// NewClusterFromDBX returns a Cluster of already connected databases, and starts checking the health
+// of the replicas
+func NewClusterFromDBX(primary *DBX, replicas []*DBX, opts ClusterOptions) *Cluster {
+	c := &Cluster{primary: primary, strategy: opts.Strategy, stop: make(chan struct{})}
+
+	for i, db := range replicas {
+		c.replicas = append(c.replicas, &replica{db: db, name: fmt.Sprintf("replica %d", i+1)})
+	}
+
+	interval := opts.HealthCheckInterval
+	if interval == 0 {
+		interval = DefaultHealthCheckInterval
+	}
+
+	if interval > 0 && len(c.replicas) > 0 {
+		c.wg.Add(1)
+		go c.runEvery(interval, c.checkHealth)
+	}
+
+	if opts.MaxReplicaLag > 0 && len(c.replicas) > 0 {
+		lagInterval := opts.LagCheckInterval
+		if lagInterval <= 0 {
+			lagInterval = DefaultHealthCheckInterval
+		}
+
+		c.wg.Add(1)
+		go c.runEvery(lagInterval, func(ctx context.Context, timeout time.Duration) {
+			c.checkLag(ctx, timeout, opts.MaxReplicaLag)
+		})
+	}
+
+	return c
+}
+
+// Primary returns the primary database
+func (c *Cluster) Primary() *DBX {
+	return c.primary
+}
+
+// Reader returns the database serving the reads made with ctx
+func (c *Cluster) Reader(ctx context.Context) *DBX {
+	if usePrimary(ctx) {
+		return c.primary
+	}
+
+	var healthy []*replica
+	for _, r := range c.replicas {
+		if r.available() {
+			healthy = append(healthy, r)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return c.primary
+	}
+
+	if c.strategy == LeastLatency {
+		best := healthy[0]
+		for _, r := range healthy[1:] {
+			if atomic.LoadInt64(&r.latency) < atomic.LoadInt64(&best.latency) {
+				best = r
+			}
+		}
+
+		return best.db
+	}
+
+	return healthy[int(atomic.AddUint32(&c.next, 1)-1)%len(healthy)].db
+}
+
+// Close stops the health checks and closes every database of the cluster. Later calls return the error
+// of the first one.
+func (c *Cluster) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		c.wg.Wait()
+
+		c.closeErr = c.primary.Close()
+		for _, r := range c.replicas {
+			if err := r.db.Close(); c.closeErr == nil {
+				c.closeErr = err
+			}
+		}
+	})
+
+	return c.closeErr
+}
+
+// runEvery runs check every interval until the cluster is closed
+func (c *Cluster) runEvery(interval time.Duration, check func(ctx context.Context, timeout time.Duration)) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			check(context.Background(), interval)
+		}
+	}
+}
+
+// checkHealth pings every replica, taking it out of rotation while it doesn't answer within timeout
+func (c *Cluster) checkHealth(ctx context.Context, timeout time.Duration) {
+	for _, r := range c.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		err := r.db.db.PingContext(pingCtx)
+		cancel()
+
+		if err == nil {
+			r.observeLatency(time.Since(start))
+		}
+
+		if r.setDown(err != nil) {
+			if err != nil {
+				c.primary.logEvent(LevelReplica, r.name+" is unreachable, removed from rotation", err)
+			} else {
+				c.primary.logEvent(LevelReplica, r.name+" is reachable again, back in rotation", nil)
+			}
+		}
+	}
+}
+
+func (r *replica) available() bool {
+	return atomic.LoadInt32(&r.down) == 0 && atomic.LoadInt32(&r.lagging) == 0
+}
+
+// setDown updates the health of the replica and tells whether it changed
+func (r *replica) setDown(down bool) bool {
+	return swapFlag(&r.down, down)
+}
+
+// setLagging updates the lag state of the replica and tells whether it changed
+func (r *replica) setLagging(lagging bool) bool {
+	return swapFlag(&r.lagging, lagging)
+}
+
+func swapFlag(flag *int32, set bool) bool {
+	var v int32
+	if set {
+		v = 1
+	}
+
+	return atomic.SwapInt32(flag, v) != v
+}
+
+// observeLatency adds a ping duration to the moving average of the replica
+func (r *replica) observeLatency(d time.Duration) {
+	old := atomic.LoadInt64(&r.latency)
+	if old == 0 {
+		atomic.StoreInt64(&r.latency, int64(d))
+		return
+	}
+
+	atomic.StoreInt64(&r.latency, (old*4+int64(d))/5)
+}
+
+// route returns the context of the next statement run through the cluster, carrying the SkipLog requested
+// on the cluster
+func (c *Cluster) route(ctx context.Context) context.Context {
+	if atomic.CompareAndSwapInt32(&c.skipLog, 1, 0) {
+		return withSkipLog(ctx)
+	}
+
+	return ctx
+}
+
+// SkipLog skips logging the next statement run through the cluster
+func (c *Cluster) SkipLog() {
+	atomic.StoreInt32(&c.skipLog, 1)
+}
+
+func (c *Cluster) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+	return c.QueryxContext(context.Background(), query, args...)
+}
+
+func (c *Cluster) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return c.Reader(ctx).QueryxContext(c.route(ctx), query, args...)
+}
+
+func (c *Cluster) QueryRowx(query string, args ...interface{}) *sqlx.Row {
+	return c.QueryRowxContext(context.Background(), query, args...)
+}
+
+func (c *Cluster) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	return c.Reader(ctx).QueryRowxContext(c.route(ctx), query, args...)
+}
+
+func (c *Cluster) Select(dest interface{}, query string, args ...interface{}) error {
+	return c.SelectContext(context.Background(), dest, query, args...)
+}
+
+func (c *Cluster) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return c.Reader(ctx).SelectContext(c.route(ctx), dest, query, args...)
+}
+
+func (c *Cluster) NamedSelect(dest interface{}, query string, arg interface{}) error {
+	query, args, err := sqlx.Named(query, arg)
+	if err != nil {
+		return err
+	}
+
+	return c.SelectContext(context.Background(), dest, query, args...)
+}
+
+func (c *Cluster) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.ExecContext(context.Background(), query, args...)
+}
+
+func (c *Cluster) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.primary.ExecContext(c.route(ctx), query, args...)
+}
+
+func (c *Cluster) NamedExec(query string, arg interface{}) (sql.Result, error) {
+	return c.NamedExecContext(context.Background(), query, arg)
+}
+
+func (c *Cluster) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	return c.primary.NamedExecContext(c.route(ctx), query, arg)
+}
+
+func (c *Cluster) NamedInsert(target interface{}, tableName string, params []string, arg map[string]interface{}) (string, []interface{}, error) {
+	return c.primary.NamedInsert(target, tableName, params, arg)
+}
+
+func (c *Cluster) Rebind(query string) string {
+	return c.primary.Rebind(query)
+}
+
+func (c *Cluster) MustBegin() *Tx {
+	return c.primary.MustBegin()
+}
+
+func (c *Cluster) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	return c.primary.BeginTxx(ctx, opts)
+}
+
+func (c *Cluster) RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(*Tx) error) error {
+	return c.primary.RunInTx(ctx, opts, fn)
+}
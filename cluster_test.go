@@ -0,0 +1,141 @@
+package dbx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeCluster(t *testing.T, strategy ReplicaStrategy, numReplicas int) (*Cluster, *fakeDB, []*fakeDB) {
+	primary, primaryDB := newFakeDBX(PostgresDriver)
+
+	var replicas []*DBX
+	var replicaDBs []*fakeDB
+	for i := 0; i < numReplicas; i++ {
+		db, fdb := newFakeDBX(PostgresDriver)
+		replicas = append(replicas, db)
+		replicaDBs = append(replicaDBs, fdb)
+	}
+
+	c := NewClusterFromDBX(primary, replicas, ClusterOptions{Strategy: strategy, HealthCheckInterval: -1})
+	t.Cleanup(func() { c.Close() })
+
+	return c, primaryDB, replicaDBs
+}
+
+func Test_Cluster_Routing(t *testing.T) {
+	c, primary, replicas := newFakeCluster(t, RoundRobin, 2)
+	ctx := context.Background()
+
+	var dest []int
+	require.NoError(t, c.Select(&dest, "Select 1"))
+	require.NoError(t, c.SelectContext(ctx, &dest, "Select 2"))
+
+	rows, err := c.Queryx("Select 3")
+	require.NoError(t, err)
+	rows.Close()
+
+	_, err = c.Exec("Update t Set a = 1")
+	require.NoError(t, err)
+
+	_, err = c.NamedExecContext(ctx, "Update t Set a = :a", map[string]interface{}{"a": 1})
+	require.NoError(t, err)
+
+	require.NoError(t, c.SelectContext(WithPrimary(ctx), &dest, "Select 4"))
+
+	require.NoError(t, c.RunInTx(ctx, nil, func(tx *Tx) error {
+		_, err := tx.Exec("Delete From t")
+		return err
+	}))
+
+	require.Equal(t, []string{"Select 1", "Select 3"}, replicas[0].log())
+	require.Equal(t, []string{"Select 2"}, replicas[1].log())
+	require.Equal(t, []string{"Update t Set a = 1", "Update t Set a = $1", "Select 4", "BEGIN", "Delete From t", "COMMIT"}, primary.log())
+}
+
+func Test_Cluster_HealthCheck(t *testing.T) {
+	c, primary, replicas := newFakeCluster(t, RoundRobin, 2)
+
+	var out bytes.Buffer
+	c.Primary().SetLogger(LogError, &out)
+
+	down := errors.New("connection refused")
+	replicas[0].ping = func() error { return down }
+
+	c.checkHealth(context.Background(), DefaultHealthCheckInterval)
+	require.Contains(t, out.String(), `"msg":"replica 1 is unreachable, removed from rotation"`)
+
+	var dest []int
+	for i := 0; i < 3; i++ {
+		require.NoError(t, c.Select(&dest, "Select 1"))
+	}
+	require.Empty(t, replicas[0].log())
+	require.Len(t, replicas[1].log(), 3)
+
+	replicas[1].ping = func() error { return down }
+	c.checkHealth(context.Background(), DefaultHealthCheckInterval)
+
+	require.NoError(t, c.Select(&dest, "Select 2"))
+	require.Equal(t, []string{"Select 2"}, primary.log())
+
+	replicas[0].ping = nil
+	out.Reset()
+	c.checkHealth(context.Background(), DefaultHealthCheckInterval)
+	require.Contains(t, out.String(), `"msg":"replica 1 is reachable again, back in rotation"`)
+	require.Equal(t, 1, strings.Count(out.String(), "\n"))
+
+	require.NoError(t, c.Select(&dest, "Select 3"))
+	require.Equal(t, []string{"Select 3"}, replicas[0].log())
+}
+
+func Test_Cluster_LeastLatency(t *testing.T) {
+	c, _, replicas := newFakeCluster(t, LeastLatency, 3)
+
+	c.replicas[0].latency = 30
+	c.replicas[1].latency = 10
+	c.replicas[2].latency = 20
+
+	var dest []int
+	require.NoError(t, c.Select(&dest, "Select 1"))
+	require.NoError(t, c.Select(&dest, "Select 2"))
+
+	require.Empty(t, replicas[0].log())
+	require.Equal(t, []string{"Select 1", "Select 2"}, replicas[1].log())
+
+	c.replicas[1].setDown(true)
+	require.NoError(t, c.Select(&dest, "Select 3"))
+	require.Equal(t, []string{"Select 3"}, replicas[2].log())
+}
+
+func Test_Cluster_SkipLog(t *testing.T) {
+	c, _, _ := newFakeCluster(t, RoundRobin, 1)
+
+	var out bytes.Buffer
+	c.Primary().SetLogger(LogDebug, &out)
+	c.replicas[0].db.SetLogger(LogDebug, &out)
+
+	c.SkipLog()
+	_, err := c.Exec("Update t Set a = 1")
+	require.NoError(t, err)
+
+	var dest []int
+	require.NoError(t, c.Select(&dest, "Select 1"))
+
+	require.NotContains(t, out.String(), "Update t")
+	require.Contains(t, out.String(), "Select 1")
+
+	// the flags of the databases shared by every goroutine are left alone
+	require.False(t, c.Primary().skipLog)
+	require.False(t, c.replicas[0].db.skipLog)
+}
+
+func Test_Cluster_CloseTwice(t *testing.T) {
+	c, _, _ := newFakeCluster(t, RoundRobin, 1)
+
+	require.NoError(t, c.Close())
+	require.NoError(t, c.Close())
+}
@@ -1,14 +1,18 @@
 package dbx
 
 import (
+	"context"
 	"time"
 
 	"database/sql"
+	"database/sql/driver"
 
 	"fmt"
 	"reflect"
+	"sort"
 
 	"strings"
+	"sync"
 
 	"regexp"
 
@@ -17,83 +21,263 @@ import (
 
 var regCmts = regexp.MustCompile("(--.*)(\\n)")
 
-func queryX(querier dbxInternal, query string, args ...interface{}) (*sqlx.Rows, error) {
-	query = querier.getDB().Rebind(query)
+func queryX(ctx context.Context, querier dbxInternal, query string, args ...interface{}) (*sqlx.Rows, error) {
+	var rows *sqlx.Rows
 
-	timeStart := time.Now()
+	err := retryStatement(ctx, querier, query, isRead(query), func() error {
+		return runQuery(ctx, querier, query, args, func(ctx context.Context, event *QueryEvent) error {
+			var err error
+			rows, err = querier.getDB().QueryxContext(ctx, event.Query, event.Args...)
+			return err
+		})
+	})
 
-	rows, err := querier.getDB().Queryx(query, args...)
+	return rows, err
+}
 
-	querier.logQuery(query, time.Now().Sub(timeStart), err, args...)
+func queryRowx(ctx context.Context, querier dbxInternal, query string, args ...interface{}) *sqlx.Row {
+	var row *sqlx.Row
 
-	return rows, err
+	err := retryStatement(ctx, querier, query, isRead(query), func() error {
+		return runQuery(ctx, querier, query, args, func(ctx context.Context, event *QueryEvent) error {
+			row = querier.getDB().QueryRowxContext(ctx, event.Query, event.Args...)
+			return row.Err()
+		})
+	})
+
+	// the row carries the hook error, or the query error
+	if err != nil {
+		row = errorRow(err)
+	}
+
+	return row
 }
 
-func queryRowx(querier dbxInternal, query string, args ...interface{}) *sqlx.Row {
-	query = querier.getDB().Rebind(query)
+// errRowDB is a database whose only statement fails with the error passed as its argument, see errorRow
+var errRowDB = sqlx.NewDb(sql.OpenDB(errRowConnector{}), "")
 
-	timeStart := time.Now()
+// errorRow returns a *sqlx.Row whose Scan returns err. sqlx keeps the error of a row unexported, so the
+// row is queried from errRowDB.
+func errorRow(err error) *sqlx.Row {
+	return errRowDB.QueryRowx("", rowError{err})
+}
 
-	row := querier.getDB().QueryRowx(query, args...)
+type rowError struct {
+	err error
+}
 
-	querier.logQuery(query, time.Now().Sub(timeStart), row.Err(), args...)
+type errRowConnector struct{}
 
-	return row
+func (errRowConnector) Connect(context.Context) (driver.Conn, error) {
+	return errRowConn{}, nil
 }
 
-func selectX(querier dbxInternal, dest interface{}, query string, args ...interface{}) error {
-	query = querier.getDB().Rebind(query)
+func (errRowConnector) Driver() driver.Driver {
+	return nil
+}
+
+type errRowConn struct{}
+
+func (errRowConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
 
-	timeStart := time.Now()
+func (errRowConn) Close() error {
+	return nil
+}
 
-	err := querier.getDB().Select(dest, query, args...)
+func (errRowConn) Begin() (driver.Tx, error) {
+	return nil, driver.ErrSkip
+}
 
-	querier.logQuery(query, time.Now().Sub(timeStart), err, args...)
+// CheckNamedValue lets the rowError argument through to QueryContext
+func (errRowConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
 
-	return err
+func (errRowConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return nil, args[0].Value.(rowError).err
 }
 
-func exec(querier dbxInternal, query string, args ...interface{}) (sql.Result, error) {
-	query = querier.getDB().Rebind(query)
+func selectX(ctx context.Context, querier dbxInternal, dest interface{}, query string, args ...interface{}) error {
+	// a retry drops the rows appended to dest by the failed attempt
+	slice := reflect.Indirect(reflect.ValueOf(dest))
+	length := -1
+	if slice.Kind() == reflect.Slice && slice.CanSet() {
+		length = slice.Len()
+	}
+
+	return retryStatement(ctx, querier, query, isRead(query), func() error {
+		if length >= 0 {
+			slice.SetLen(length)
+		}
 
-	timeStart := time.Now()
+		return runQuery(ctx, querier, query, args, func(ctx context.Context, event *QueryEvent) error {
+			return querier.getDB().SelectContext(ctx, dest, event.Query, event.Args...)
+		})
+	})
+}
 
-	res, err := querier.getDB().Exec(query, args...)
+func exec(ctx context.Context, querier dbxInternal, query string, args ...interface{}) (sql.Result, error) {
+	var res sql.Result
 
-	querier.logQuery(query, time.Now().Sub(timeStart), err, args...)
+	err := retryStatement(ctx, querier, query, false, func() error {
+		return runQuery(ctx, querier, query, args, func(ctx context.Context, event *QueryEvent) error {
+			var err error
+			res, err = querier.getDB().ExecContext(ctx, event.Query, event.Args...)
+			if err == nil {
+				event.RowsAffected, _ = res.RowsAffected()
+			}
+			return err
+		})
+	})
 
 	return res, err
 }
 
-func namedExec(querier dbxInternal, query string, arg interface{}) (sql.Result, error) {
-	query = querier.getDB().Rebind(query)
+func namedExec(ctx context.Context, querier dbxInternal, query string, arg interface{}) (sql.Result, error) {
+	var res sql.Result
 
-	timeStart := time.Now()
+	err := retryStatement(ctx, querier, query, false, func() error {
+		return runQuery(ctx, querier, query, []interface{}{arg}, func(ctx context.Context, event *QueryEvent) error {
+			var err error
+			res, err = querier.getDB().NamedExecContext(ctx, event.Query, event.Args[0])
+			if err == nil {
+				event.RowsAffected, _ = res.RowsAffected()
+			}
+			return err
+		})
+	})
 
-	res, err := querier.getDB().NamedExec(query, arg)
+	return res, err
+}
 
-	querier.logQuery(query, time.Now().Sub(timeStart), err, arg)
+type skipLogCtxKey struct{}
 
-	return res, err
+// withSkipLog returns a context whose statements aren't logged. It lets a Cluster skip the log of a
+// statement without setting the SkipLog flag of a database shared by every goroutine.
+func withSkipLog(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipLogCtxKey{}, true)
+}
+
+func skipLogged(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipLogCtxKey{}).(bool)
+	return skip
+}
+
+// runQuery rebinds the query for the driver and runs it between the registered hooks,
+// timing and logging it the same way for DBX and Tx
+func runQuery(ctx context.Context, querier dbxInternal, query string, args []interface{}, run func(ctx context.Context, event *QueryEvent) error) error {
+	event := &QueryEvent{
+		Query:        querier.getDB().Rebind(query),
+		Args:         args,
+		InTx:         querier.inTx(),
+		RowsAffected: -1,
+	}
+
+	obs := querier.getObservers()
+	hooks := obs.hooks
+
+	ran, err := runBeforeHooks(ctx, hooks, event)
+	if err != nil {
+		event.Err = err
+		if !skipLogged(ctx) {
+			querier.logQuery(event.Query, notRun, err, event.Args...)
+		}
+		runAfterHooks(ctx, hooks[:ran], event)
+
+		return err
+	}
+
+	span := startQuerySpan(ctx, querier, event)
+
+	event.Start = time.Now()
+	event.Err = ClassifyError(run(ctx, event))
+	event.Duration = time.Now().Sub(event.Start)
+
+	if span != nil {
+		endQuerySpan(span, event)
+	}
+
+	if !skipLogged(ctx) {
+		querier.logQuery(event.Query, event.Duration, event.Err, event.Args...)
+	}
+	if obs.metrics != nil {
+		obs.metrics.observe(event.Query, event.Duration, event.Err)
+	}
+	runAfterHooks(ctx, hooks, event)
+
+	if event.Err != nil {
+		return newQueryError(querier, event)
+	}
+
+	return nil
+}
+
+// startQuerySpan starts the span of a statement, as a child of the transaction span when run inside a Tx
+func startQuerySpan(ctx context.Context, querier dbxInternal, event *QueryEvent) Span {
+	obs := querier.getObservers()
+	if obs.tracer == nil {
+		return nil
+	}
+
+	if obs.traceCtx != nil {
+		ctx = obs.traceCtx
+	}
+
+	_, span := obs.tracer.Start(ctx, statementType(event.Query))
+	span.SetAttribute(AttrDBSystem, dbSystem(querier.driverName()))
+	span.SetAttribute(AttrDBStatement, strings.TrimSpace(cleanQuery(event.Query)))
+
+	return span
+}
+
+func endQuerySpan(span Span, event *QueryEvent) {
+	if event.RowsAffected >= 0 {
+		span.SetAttribute(AttrRowsAffected, event.RowsAffected)
+	}
+
+	if event.Err != nil {
+		span.RecordError(event.Err)
+	}
+
+	span.End()
 }
 
 // namedInsert generates the query and arguments for an insert
 // target can either be a slice, ptr to a slice, struct, ptr to a struct
-// params is the list of params/columns to update
+// params is the list of params/columns to update. When nil, every db tagged field is inserted except those
+// tagged auto or default, eg. `db:"id,auto"`, the fields of nested structs, and those tagged omitempty that
+// are zero in every struct. An empty but non nil params generates no column.
 // valueMapper holds the values you want to override. When the process is done, valueMapper will list all
 // generated params with their values as well as all original parameters
 func namedInsert(target interface{}, tableName string, params []string, valueMapper map[string]interface{}) (string, []interface{}, error) {
-	var err error
-	var valuesPart string
-	value := reflect.ValueOf(target)
-
 	if valueMapper == nil {
 		valueMapper = map[string]interface{}{}
 	}
 
+	params, err := insertColumns(target, params)
+	if err != nil {
+		return "", nil, err
+	}
+
+	q, err := buildNamedInsert(target, tableName, params, valueMapper)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return sqlx.Named(q, valueMapper)
+}
+
+// buildNamedInsert returns the insert query for target with named params, and adds their values to valueMapper
+func buildNamedInsert(target interface{}, tableName string, params []string, valueMapper map[string]interface{}) (string, error) {
+	var err error
+	var valuesPart string
+	value := reflect.ValueOf(target)
+
 	if value.Kind() == reflect.Ptr {
 		if value.IsNil() {
-			return "", nil, &NilPointerErr{"nil pointer passed to namedInsert target"}
+			return "", &NilPointerErr{"nil pointer passed to namedInsert target"}
 		}
 
 		value = reflect.Indirect(value)
@@ -102,24 +286,22 @@ func namedInsert(target interface{}, tableName string, params []string, valueMap
 	if value.Kind() == reflect.Struct {
 		valuesPart, err = buildInsertQueryValues(0, value.Interface(), params, valueMapper)
 		if err != nil {
-			return "", nil, err
+			return "", err
 		}
 	} else if value.Kind() == reflect.Slice {
 		valuesPart, err = namedInsertSlice(value, params, valueMapper)
 		if err != nil {
-			return "", nil, err
+			return "", err
 		}
 	} else {
-		return "", nil, &WrongTypeErr{"target type not accepted"}
+		return "", &WrongTypeErr{"target type not accepted"}
 	}
 
-	q := fmt.Sprintf("Insert into %s (%s) Values %s", tableName, strings.Join(params, ","), valuesPart)
-
-	return sqlx.Named(q, valueMapper)
+	return fmt.Sprintf("Insert into %s (%s) Values %s", tableName, strings.Join(params, ","), valuesPart), nil
 }
 
 func namedInsertSlice(sliceValue reflect.Value, paramNames []string, m map[string]interface{}) (string, error) {
-	var valuesPart string
+	var valuesPart strings.Builder
 
 	if sliceValue.Len() == 0 {
 		return "", &EmptySliceErr{"target slice is empty"}
@@ -141,74 +323,410 @@ func namedInsertSlice(sliceValue reflect.Value, paramNames []string, m map[strin
 			return "", err
 		}
 
-		valuesPart += qValues
+		valuesPart.WriteString(qValues)
 	}
 
-	return valuesPart, nil
+	return valuesPart.String(), nil
 }
 
 // buildInsertQueryValues returns the values part query for a struct. eg. (id_0, name_0, timestamp_0)
 func buildInsertQueryValues(index int, target interface{}, paramNames []string, m map[string]interface{}) (string, error) {
+	values, err := structParamValues(target, paramNames, m)
+	if err != nil {
+		return "", err
+	}
+
+	return BuildInsertParams(m, index, paramNames, values), nil
+}
+
+// structParamValues returns the value of each param for a struct. The value is taken from m when overridden,
+// otherwise from the field of the same name, or else from the field with the same db tag
+func structParamValues(target interface{}, paramNames []string, m map[string]interface{}) ([]interface{}, error) {
 	value := reflect.ValueOf(target)
 
 	if value.Kind() == reflect.Ptr {
 		if value.IsNil() {
-			return "", &NilPointerErr{"nil pointer passed to buildInsertValues target"}
+			return nil, &NilPointerErr{"nil pointer passed to buildInsertValues target"}
 		}
 
 		value = value.Elem()
 	}
 
-	tagMap, err := mapTypeFieldsTag("db", reflect.TypeOf(value.Interface()))
+	meta, err := typeMetadata("db", value.Type())
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	var values []interface{}
+	return meta.paramValues(value, paramNames, m)
+}
 
-	for _, param := range paramNames {
-		if _, ok := m[param]; ok {
-			values = append(values, m[param])
+// fieldInfo describes a field reachable from a struct, directly or through embedded and nested structs
+type fieldInfo struct {
+	// Name is the column the field maps to. Fields of nested structs are prefixed with the name of
+	// the struct field holding them. eg. address.city
+	Name    string
+	Index   []int
+	Options map[string]bool
+	Field   reflect.StructField
+
+	// Nested is set for the fields of nested structs, whose Name is prefixed
+	Nested bool
+}
+
+// structMeta is the reflected metadata of a struct type, shared by every value of that type
+type structMeta struct {
+	t       reflect.Type
+	tagName string
+	fields  map[string]*fieldInfo
+
+	// columns lists the tagged fields inserted when no column is given, in declaration order
+	columns []string
+
+	// indexes caches the field index resolved for each param. Params matching no field aren't cached so
+	// that callers passing arbitrary names can't grow it.
+	indexes sync.Map
+}
+
+type structMetaKey struct {
+	tagName string
+	t       reflect.Type
+}
+
+// structMetaCache holds a *structMeta per tag name and struct type
+var structMetaCache sync.Map
+
+// typeMetadata returns the cached metadata of t, mapping its fields with mapTypeFieldsTag on first use
+func typeMetadata(tagName string, t reflect.Type) (*structMeta, error) {
+	key := structMetaKey{tagName, t}
+	if meta, ok := structMetaCache.Load(key); ok {
+		return meta.(*structMeta), nil
+	}
+
+	meta, err := newStructMeta(tagName, t)
+	if err != nil {
+		return nil, err
+	}
+
+	actual, _ := structMetaCache.LoadOrStore(key, meta)
+	return actual.(*structMeta), nil
+}
+
+func newStructMeta(tagName string, t reflect.Type) (*structMeta, error) {
+	fields, err := mapTypeFieldsTag(tagName, t)
+	if err != nil {
+		return nil, err
+	}
+
+	return &structMeta{t: t, tagName: tagName, fields: fields, columns: autoColumns(fields)}, nil
+}
+
+// autoColumns returns the columns of fields, except the fields with the auto or default options, which the
+// database generates, and nested structs and their fields, whose prefixed names aren't columns of the table.
+// A dotted name in the tag of a top level field, eg. `db:"address.city"`, is kept as the column name.
+func autoColumns(fields map[string]*fieldInfo) []string {
+	var infos []*fieldInfo
+	for _, field := range fields {
+		ft := field.Field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if field.Options["auto"] || field.Options["default"] || field.Nested || isNestedStruct(ft) {
 			continue
 		}
 
-		f := value.FieldByName(param)
-		if f.Kind() != reflect.Invalid {
-			values = append(values, value.FieldByName(param).Interface())
+		infos = append(infos, field)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		a, b := infos[i].Index, infos[j].Index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+
+	columns := make([]string, len(infos))
+	for i, field := range infos {
+		columns[i] = field.Name
+	}
+
+	return columns
+}
+
+// insertColumns returns params, or when nil, the auto columns of the structs held by target. Columns tagged
+// omitempty are left out when they hold a zero value in every struct.
+// An empty but non nil params is returned as is, only nil generates the columns.
+func insertColumns(target interface{}, params []string) ([]string, error) {
+	if params != nil {
+		return params, nil
+	}
+
+	t := reflect.TypeOf(target)
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice) {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, &WrongTypeErr{"columns can only be generated for structs"}
+	}
+
+	meta, err := typeMetadata("db", t)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := meta.nonEmptyColumns(reflect.ValueOf(target))
+	if len(columns) == 0 {
+		return nil, &MissingParamErr{fmt.Sprintf("no db tagged column to insert in %s", t)}
+	}
+
+	return columns, nil
+}
+
+// nonEmptyColumns returns the auto columns, without the omitempty ones that are zero in every struct of target
+func (meta *structMeta) nonEmptyColumns(target reflect.Value) []string {
+	var omitEmpty bool
+	for _, column := range meta.columns {
+		omitEmpty = omitEmpty || meta.fields[column].Options["omitempty"]
+	}
+
+	if !omitEmpty {
+		return meta.columns
+	}
+
+	target = reflect.Indirect(target)
+	items := []reflect.Value{target}
+	if target.Kind() == reflect.Slice {
+		items = make([]reflect.Value, 0, target.Len())
+		for i := 0; i < target.Len(); i++ {
+			if item := reflect.Indirect(target.Index(i)); item.IsValid() {
+				items = append(items, item)
+			}
+		}
+	}
+
+	columns := make([]string, 0, len(meta.columns))
+	for _, column := range meta.columns {
+		field := meta.fields[column]
+		if !field.Options["omitempty"] {
+			columns = append(columns, column)
 			continue
 		}
 
-		if field, ok := tagMap[param]; ok {
-			values = append(values, value.FieldByName(field.Name).Interface())
+		for _, item := range items {
+			if v := fieldInterface(item, field.Index); v != nil && !reflect.ValueOf(v).IsZero() {
+				columns = append(columns, column)
+				break
+			}
+		}
+	}
+
+	return columns
+}
+
+// fieldIndex returns the index path of the field matching param, by field name first, then by tag
+func (meta *structMeta) fieldIndex(param string) ([]int, bool) {
+	if index, ok := meta.indexes.Load(param); ok {
+		return index.([]int), true
+	}
+
+	var index []int
+	if field, ok := meta.t.FieldByName(param); ok && !meta.ignored(field.Index) {
+		index = field.Index
+	} else if field, ok := meta.fields[param]; ok {
+		index = field.Index
+	}
+
+	if index == nil {
+		return nil, false
+	}
+
+	meta.indexes.Store(param, index)
+	return index, true
+}
+
+// ignored tells whether the field at index, or a struct holding it, is tagged "-"
+func (meta *structMeta) ignored(index []int) bool {
+	t := meta.t
+	for _, x := range index {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		field := t.Field(x)
+		if field.Tag.Get(meta.tagName) == "-" {
+			return true
+		}
+
+		t = field.Type
+	}
+
+	return false
+}
+
+// paramValues returns the value of each param for value, a struct of the meta type
+func (meta *structMeta) paramValues(value reflect.Value, paramNames []string, m map[string]interface{}) ([]interface{}, error) {
+	values := make([]interface{}, 0, len(paramNames))
+
+	for _, param := range paramNames {
+		if v, ok := m[param]; ok {
+			values = append(values, v)
 			continue
 		}
 
-		return "", &MissingParamErr{error: fmt.Sprintf("param '%s' not found", param)}
+		index, ok := meta.fieldIndex(param)
+		if !ok {
+			return nil, &MissingParamErr{error: fmt.Sprintf("param '%s' not found", param)}
+		}
+
+		values = append(values, fieldInterface(value, index))
 	}
 
-	return BuildInsertParams(m, index, paramNames, values), nil
+	return values, nil
 }
 
-// mapTypeFieldsTag values of tags of all fields in the given struct Type
-func mapTypeFieldsTag(tagName string, t reflect.Type) (map[string]reflect.StructField, error) {
+var (
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// mapTypeFieldsTag maps the values of tags of all fields in the given struct Type, including the fields of
+// embedded structs and, prefixed with their own name, of nested structs, the way sqlx maps columns.
+// Fields tagged "-" are skipped, and options following the name in the tag (eg. `db:"name,omitempty"`)
+// are kept in fieldInfo.Options, see autoColumns and insertColumns for those honoured. When several fields share a name, the shallowest one wins.
+func mapTypeFieldsTag(tagName string, t reflect.Type) (map[string]*fieldInfo, error) {
 	if t.Kind() != reflect.Struct {
 		return nil, &WrongTypeErr{"not a struct"}
 	}
 
-	m := map[string]reflect.StructField{}
+	type walkItem struct {
+		t      reflect.Type
+		index  []int
+		prefix string
+		seen   map[reflect.Type]bool
+	}
+
+	m := map[string]*fieldInfo{}
+	queue := []walkItem{{t: t, seen: map[reflect.Type]bool{t: true}}}
+
+	for len(queue) > 0 {
+		item := queue[0]
+		queue = queue[1:]
 
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
+		for i := 0; i < item.t.NumField(); i++ {
+			field := item.t.Field(i)
+
+			tag, tagged := field.Tag.Lookup(tagName)
+			if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+				continue
+			}
+
+			name, options := parseFieldTag(tag)
+			index := append(append([]int{}, item.index...), i)
+
+			if name != "" {
+				if _, ok := m[item.prefix+name]; !ok {
+					m[item.prefix+name] = &fieldInfo{Name: item.prefix + name, Index: index, Options: options, Field: field, Nested: item.prefix != ""}
+				}
+			}
+
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			if !isNestedStruct(ft) || item.seen[ft] {
+				continue
+			}
+
+			prefix := item.prefix
+			switch {
+			case name != "":
+				prefix += name + "."
+			case !field.Anonymous:
+				if tagged {
+					continue
+				}
+				prefix += strings.ToLower(field.Name) + "."
+			}
+
+			seen := map[reflect.Type]bool{ft: true}
+			for k := range item.seen {
+				seen[k] = true
+			}
 
-		v, ok := field.Tag.Lookup(tagName)
-		if ok {
-			m[v] = field
+			queue = append(queue, walkItem{t: ft, index: index, prefix: prefix, seen: seen})
 		}
 	}
 
 	return m, nil
 }
 
+// isNestedStruct tells whether the fields of a struct type map to their own columns,
+// as opposed to structs handled by the driver like time.Time or sql.NullString
+func isNestedStruct(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t == timeType {
+		return false
+	}
+
+	return !t.Implements(valuerType) && !reflect.PtrTo(t).Implements(valuerType) && !reflect.PtrTo(t).Implements(scannerType)
+}
+
+// parseFieldTag splits a tag into the column name and its options. eg. "name,omitempty"
+func parseFieldTag(tag string) (string, map[string]bool) {
+	parts := strings.Split(tag, ",")
+
+	var options map[string]bool
+	for _, opt := range parts[1:] {
+		if opt = strings.TrimSpace(opt); opt != "" {
+			if options == nil {
+				options = map[string]bool{}
+			}
+			options[opt] = true
+		}
+	}
+
+	return strings.TrimSpace(parts[0]), options
+}
+
+// fieldInterface returns the value of the field at index, or nil if it sits behind a nil embedded pointer
+func fieldInterface(v reflect.Value, index []int) interface{} {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil
+			}
+
+			v = v.Elem()
+		}
+
+		v = v.Field(x)
+	}
+
+	return v.Interface()
+}
+
+// fieldByIndexAlloc returns the field at index, allocating the nil embedded pointers on the way
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+
+			v = v.Elem()
+		}
+
+		v = v.Field(x)
+	}
+
+	return v
+}
+
 func ReturningAll(query string) string {
 	return query + " Returning *"
 }
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"fmt"
+	"reflect"
 
 	"github.com/jackc/pgx/pgtype"
 	"github.com/satori/go.uuid"
@@ -497,3 +498,335 @@ func Test_removeComments(t *testing.T) {
 	output := removeComments(query)
 	fmt.Println(output)
 }
+
+func Test_namedInsert_WithEmbeddedStructs(t *testing.T) {
+	type Timestamps struct {
+		CreatedAt string `db:"created_at"`
+		UpdatedAt string `db:"updated_at"`
+	}
+
+	type Audit struct {
+		CreatedBy string `db:"created_by"`
+	}
+
+	type address struct {
+		City    string `db:"city"`
+		Country string
+	}
+
+	type person struct {
+		Timestamps
+		*Audit
+		ID       int     `db:"id"`
+		Name     string  `db:"name,omitempty"`
+		Password string  `db:"-"`
+		Address  address `db:"address"`
+		Billing  address
+	}
+
+	cases := []struct {
+		testName      string
+		data          person
+		paramNames    []string
+		expectedQuery string
+		expectedArgs  []interface{}
+		expectedErr   error
+	}{
+		{
+			testName:      "Test with embedded struct fields",
+			data:          person{Timestamps: Timestamps{CreatedAt: "c", UpdatedAt: "u"}, Audit: &Audit{CreatedBy: "admin"}, Name: "Alpha"},
+			paramNames:    []string{"name", "created_at", "updated_at", "created_by"},
+			expectedQuery: "Insert into person (name,created_at,updated_at,created_by) Values (?,?,?,?)",
+			expectedArgs:  []interface{}{"Alpha", "c", "u", "admin"},
+		},
+		{
+			testName:      "Test with a nil embedded struct ptr",
+			data:          person{Name: "Alpha"},
+			paramNames:    []string{"name", "created_by"},
+			expectedQuery: "Insert into person (name,created_by) Values (?,?)",
+			expectedArgs:  []interface{}{"Alpha", nil},
+		},
+		{
+			testName:      "Test with nested struct fields",
+			data:          person{Address: address{City: "Sydney", Country: "Australia"}, Billing: address{City: "Paris"}},
+			paramNames:    []string{"address.city", "billing.city"},
+			expectedQuery: "Insert into person (address.city,billing.city) Values (?,?)",
+			expectedArgs:  []interface{}{"Sydney", "Paris"},
+		},
+		{
+			testName:    "Test with an ignored field",
+			data:        person{Password: "secret"},
+			paramNames:  []string{"password"},
+			expectedErr: &MissingParamErr{error: "param 'password' not found"},
+		},
+		{
+			testName:    "Test with an ignored field named by its go name",
+			data:        person{Password: "secret"},
+			paramNames:  []string{"Password"},
+			expectedErr: &MissingParamErr{error: "param 'Password' not found"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.testName, func(t *testing.T) {
+			query, args, err := namedInsert(c.data, "person", c.paramNames, map[string]interface{}{})
+			if c.expectedErr != nil {
+				require.Equal(t, c.expectedErr, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, c.expectedQuery, query)
+			require.Equal(t, c.expectedArgs, args)
+		})
+	}
+}
+
+func Test_mapTypeFieldsTag(t *testing.T) {
+	type base struct {
+		ID   int    `db:"id"`
+		Name string `db:"base_name"`
+	}
+
+	type item struct {
+		base
+		Name string `db:"name,omitempty,auto"`
+		Self *item  `db:"self"`
+	}
+
+	m, err := mapTypeFieldsTag("db", reflect.TypeOf(item{}))
+	require.NoError(t, err)
+
+	require.Equal(t, []int{0, 0}, m["id"].Index)
+	require.Equal(t, []int{1}, m["name"].Index)
+	require.Equal(t, map[string]bool{"omitempty": true, "auto": true}, m["name"].Options)
+	require.Equal(t, []int{2}, m["self"].Index)
+	require.Nil(t, m["self.id"])
+
+	_, err = mapTypeFieldsTag("db", reflect.TypeOf(""))
+	require.Equal(t, &WrongTypeErr{"not a struct"}, err)
+}
+
+func Test_typeMetadata(t *testing.T) {
+	type person struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+
+	meta, err := typeMetadata("db", reflect.TypeOf(person{}))
+	require.NoError(t, err)
+
+	cached, err := typeMetadata("db", reflect.TypeOf(person{}))
+	require.NoError(t, err)
+	require.True(t, meta == cached)
+
+	index, ok := meta.fieldIndex("Name")
+	require.True(t, ok)
+	require.Equal(t, []int{1}, index)
+
+	index, ok = meta.fieldIndex("id")
+	require.True(t, ok)
+	require.Equal(t, []int{0}, index)
+
+	_, ok = meta.fieldIndex("missing")
+	require.False(t, ok)
+
+	_, stored := meta.indexes.Load("missing")
+	require.False(t, stored)
+}
+
+type benchPerson struct {
+	ID        int    `db:"id"`
+	Name      string `db:"name"`
+	Location  string `db:"location"`
+	IsAlive   bool   `db:"is_alive"`
+	CreatedAt string `db:"created_at"`
+}
+
+func benchPeople(n int) []benchPerson {
+	people := make([]benchPerson, n)
+	for i := range people {
+		people[i] = benchPerson{ID: i, Name: "Alpha", Location: "Australia", IsAlive: true, CreatedAt: "2020-01-01"}
+	}
+
+	return people
+}
+
+var benchColumns = []string{"id", "name", "location", "is_alive", "created_at"}
+
+func Benchmark_structParamValues(b *testing.B) {
+	people := benchPeople(10000)
+
+	b.Run("cached", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for i := range people {
+				if _, err := structParamValues(people[i], benchColumns, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	// baseline runs the code the builders used before the metadata cache
+	b.Run("baseline", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for i := range people {
+				if _, err := baselineParamValues(people[i], benchColumns, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+// baselineParamValues is structParamValues as it was before the metadata cache, reflecting over the
+// top level fields of the struct type for every row
+func baselineParamValues(target interface{}, paramNames []string, m map[string]interface{}) ([]interface{}, error) {
+	value := reflect.ValueOf(target)
+
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil, &NilPointerErr{"nil pointer passed to buildInsertValues target"}
+		}
+
+		value = value.Elem()
+	}
+
+	t := reflect.TypeOf(value.Interface())
+	tagMap := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if v, ok := field.Tag.Lookup("db"); ok {
+			tagMap[v] = field
+		}
+	}
+
+	var values []interface{}
+
+	for _, param := range paramNames {
+		if _, ok := m[param]; ok {
+			values = append(values, m[param])
+			continue
+		}
+
+		f := value.FieldByName(param)
+		if f.Kind() != reflect.Invalid {
+			values = append(values, value.FieldByName(param).Interface())
+			continue
+		}
+
+		if field, ok := tagMap[param]; ok {
+			values = append(values, value.FieldByName(field.Name).Interface())
+			continue
+		}
+
+		return nil, &MissingParamErr{error: fmt.Sprintf("param '%s' not found", param)}
+	}
+
+	return values, nil
+}
+
+func Benchmark_namedInsert(b *testing.B) {
+	people := benchPeople(10000)
+
+	for n := 0; n < b.N; n++ {
+		if _, _, err := namedInsert(people, "person", benchColumns, map[string]interface{}{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Test_namedInsert_WithAutoColumns(t *testing.T) {
+	type Timestamps struct {
+		CreatedAt string `db:"created_at,default"`
+		UpdatedAt string `db:"updated_at"`
+	}
+
+	type address struct {
+		City string `db:"city"`
+	}
+
+	type person struct {
+		ID int `db:"id,auto"`
+		Timestamps
+		Name     string `db:"name"`
+		Nickname string `db:"nickname,omitempty"`
+		Comment  string
+		Secret   string  `db:"-"`
+		Address  address `db:"address"`
+		Zip      string  `db:"address.zip"`
+	}
+
+	cases := []struct {
+		testName      string
+		data          interface{}
+		paramNames    []string
+		expectedQuery string
+		expectedArgs  []interface{}
+		expectedErr   error
+	}{
+		{
+			testName:      "Test with a struct",
+			data:          person{ID: 1, Timestamps: Timestamps{"c", "u"}, Name: "Alpha"},
+			expectedQuery: "Insert into person (updated_at,name,address.zip) Values (?,?,?)",
+			expectedArgs:  []interface{}{"u", "Alpha", ""},
+		},
+		{
+			testName:      "Test with a slice of struct ptrs",
+			data:          []*person{{Name: "Alpha"}, {Name: "Beta"}},
+			expectedQuery: "Insert into person (updated_at,name,address.zip) Values (?,?,?),(?,?,?)",
+			expectedArgs:  []interface{}{"", "Alpha", "", "", "Beta", ""},
+		},
+		{
+			testName:      "Test with an omitempty column set",
+			data:          person{Name: "Alpha", Nickname: "Al"},
+			expectedQuery: "Insert into person (updated_at,name,nickname,address.zip) Values (?,?,?,?)",
+			expectedArgs:  []interface{}{"", "Alpha", "Al", ""},
+		},
+		{
+			testName:      "Test with an omitempty column set in one struct of the slice",
+			data:          []person{{Name: "Alpha"}, {Name: "Beta", Nickname: "Bee"}},
+			expectedQuery: "Insert into person (updated_at,name,nickname,address.zip) Values (?,?,?,?),(?,?,?,?)",
+			expectedArgs:  []interface{}{"", "Alpha", "", "", "", "Beta", "Bee", ""},
+		},
+		{
+			testName:      "Test with explicit params",
+			data:          person{ID: 1, Name: "Alpha"},
+			paramNames:    []string{"id", "name"},
+			expectedQuery: "Insert into person (id,name) Values (?,?)",
+			expectedArgs:  []interface{}{1, "Alpha"},
+		},
+		{
+			testName:      "Test with empty explicit params",
+			data:          person{Name: "Alpha"},
+			paramNames:    []string{},
+			expectedQuery: "Insert into person () Values ()",
+			expectedArgs:  []interface{}{},
+		},
+		{
+			testName:    "Test with a slice of strings",
+			data:        []string{"Alpha"},
+			expectedErr: &WrongTypeErr{"columns can only be generated for structs"},
+		},
+		{
+			testName:    "Test with no tagged field",
+			data:        struct{ Name string }{"Alpha"},
+			expectedErr: &MissingParamErr{"no db tagged column to insert in struct { Name string }"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.testName, func(t *testing.T) {
+			query, args, err := namedInsert(c.data, "person", c.paramNames, nil)
+			if c.expectedErr != nil {
+				require.Equal(t, c.expectedErr, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, c.expectedQuery, query)
+			require.Equal(t, c.expectedArgs, args)
+		})
+	}
+}
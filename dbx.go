@@ -1,22 +1,25 @@
 package dbx
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 
 	"time"
 
-	"log"
-
 	"regexp"
 
 	"github.com/jmoiron/sqlx"
-	"github.com/pkg/errors"
 )
 
 const (
 	LevelSlowQuery = "SLOW_QUERY"
 	LevelDebug     = "DEBUG"
 	LevelError     = "ERROR"
+	LevelCanceled  = "CANCELED"
+	LevelTxRetry   = "TX_RETRY"
+	LevelReplica   = "REPLICA"
+	LevelRetry     = "RETRY"
 )
 
 func init() {
@@ -32,6 +35,17 @@ type Querier interface {
 	Rebind(query string) string
 }
 
+// QuerierContext is the context-aware counterpart of Querier. Cancelling the context
+// or reaching its deadline aborts the running statement.
+type QuerierContext interface {
+	QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
+	QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error)
+	Rebind(query string) string
+}
+
 type Querierx interface {
 	Querier
 	NamedInsert(target interface{}, tableName string, params []string, arg map[string]interface{}) (string, []interface{}, error)
@@ -39,9 +53,21 @@ type Querierx interface {
 	SkipLog()
 }
 
+// sqlxQuerier is implemented by both *sqlx.DB and *sqlx.Tx
+type sqlxQuerier interface {
+	Querier
+	QuerierContext
+}
+
 type dbxInternal interface {
 	Querier
-	getDB() Querier
+	getDB() sqlxQuerier
+	getObservers() observers
+	getServer() *serverInfo
+	driverName() string
+	inTx() bool
+	retryPolicy() RetryPolicy
+	logEvent(level string, msg string, err error)
 	logQuery(query string, execTime time.Duration, err error, args ...interface{}) error
 }
 
@@ -49,40 +75,151 @@ type DBX struct {
 	db     *sqlx.DB
 	driver string
 
-	errorLog   *log.Logger
-	debugLog   *log.Logger
-	slowLog    *log.Logger
-	slowLogMin time.Duration
-	logAsync   bool
-	skipLog    bool
+	loggers
+	skipLog bool
+
+	txRetry RetryPolicy
+	retry   RetryPolicy
+	observers
+
+	// server is shared by the Unsafe copies of the DBX and its transactions
+	server *serverInfo
+}
+
+// observers holds what watches the statements run through a DBX and the transactions it starts
+type observers struct {
+	hooks   []Hook
+	metrics *Metrics
+	tracer  Tracer
+
+	// traceCtx carries the span of a transaction, statement spans of the transaction are its children
+	traceCtx context.Context
 }
 
 func (dbx *DBX) MustBegin() *Tx {
-	return &Tx{
-		dbx.db.MustBegin(),
-		dbx.errorLog,
-		dbx.debugLog,
-		dbx.slowLog,
-		dbx.slowLogMin,
-		dbx.logAsync,
-		false,
+	return dbx.newTx(context.Background(), dbx.db.MustBegin())
+}
+
+// BeginTxx starts a transaction bound to ctx. The transaction is rolled back
+// by the driver if the context is cancelled before Commit.
+func (dbx *DBX) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := dbx.db.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+
+	return dbx.newTx(ctx, tx), nil
+}
+
+// RunInTx runs fn inside a transaction. The transaction is committed when fn returns nil,
+// and rolled back when it returns an error or panics. Transactions aborted by a serialization
+// failure or a deadlock are run again according to the policy set with SetTxRetryPolicy.
+func (dbx *DBX) RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(*Tx) error) error {
+	policy := dbx.txRetry
+
+	for attempt := 1; ; attempt++ {
+		err := dbx.runInTx(ctx, opts, fn)
+		if err == nil || attempt >= policy.attempts() || !policy.retryable(err) {
+			return err
+		}
+
+		dbx.logEvent(LevelTxRetry, fmt.Sprintf("retrying transaction (attempt %d of %d)", attempt+1, policy.attempts()), err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(policy.backoff(attempt)):
+		}
+	}
+}
+
+func (dbx *DBX) runInTx(ctx context.Context, opts *sql.TxOptions, fn func(*Tx) error) error {
+	tx, err := dbx.BeginTxx(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				dbx.logEvent(LevelError, "rollback after panic failed", rbErr)
+			}
+			panic(p)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			dbx.logEvent(LevelError, "rollback failed", rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetTxRetryPolicy sets how RunInTx retries conflicting transactions.
+// A policy with MaxAttempts lower than 2 disables retries.
+func (dbx *DBX) SetTxRetryPolicy(policy RetryPolicy) {
+	dbx.txRetry = policy
+}
+
+// SetRetryPolicy sets how statements failing outside a transaction are retried. Statements starting with
+// Select, Show or Explain are retried by default, any other only when run with a context from WithRetry.
+// A policy with MaxAttempts lower than 2 disables retries.
+func (dbx *DBX) SetRetryPolicy(policy RetryPolicy) {
+	dbx.retry = policy
+}
+
+func (dbx *DBX) newTx(ctx context.Context, tx *sqlx.Tx) *Tx {
+	newTx := &Tx{
+		tx:        tx,
+		driver:    dbx.driver,
+		loggers:   dbx.loggers,
+		observers: dbx.observers,
+		server:    dbx.server,
+	}
+
+	if dbx.tracer != nil {
+		var span Span
+		newTx.traceCtx, span = dbx.tracer.Start(ctx, "TRANSACTION")
+		span.SetAttribute(AttrDBSystem, dbSystem(dbx.driver))
+		newTx.span = &txSpan{span: span}
 	}
+
+	return newTx
 }
 
 func (dbx *DBX) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
-	return queryX(dbx, query, args...)
+	return queryX(context.Background(), dbx, query, args...)
+}
+
+func (dbx *DBX) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return queryX(ctx, dbx, query, args...)
 }
 
 func (dbx *DBX) QueryRowx(query string, args ...interface{}) *sqlx.Row {
-	return queryRowx(dbx, query, args...)
+	return queryRowx(context.Background(), dbx, query, args...)
+}
+
+func (dbx *DBX) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	return queryRowx(ctx, dbx, query, args...)
 }
 
 func (dbx *DBX) Select(dest interface{}, query string, args ...interface{}) error {
-	return selectX(dbx, dest, query, args...)
+	return selectX(context.Background(), dbx, dest, query, args...)
+}
+
+func (dbx *DBX) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return selectX(ctx, dbx, dest, query, args...)
 }
 
 func (dbx *DBX) Exec(query string, args ...interface{}) (sql.Result, error) {
-	return exec(dbx, query, args...)
+	return exec(context.Background(), dbx, query, args...)
+}
+
+func (dbx *DBX) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return exec(ctx, dbx, query, args...)
 }
 
 func (dbx *DBX) Rebind(query string) string {
@@ -95,7 +232,7 @@ func (dbx *DBX) Close() error {
 
 func (dbx *DBX) Unsafe() *DBX {
 	unsafe := dbx.db.Unsafe()
-	return &DBX{db: unsafe, errorLog: dbx.errorLog, debugLog: dbx.debugLog, slowLog: dbx.slowLog, slowLogMin: dbx.slowLogMin, logAsync: dbx.logAsync}
+	return &DBX{db: unsafe, driver: dbx.driver, loggers: dbx.loggers, txRetry: dbx.txRetry, retry: dbx.retry, observers: dbx.observers, server: dbx.server}
 }
 
 func (dbx *DBX) SetMaxOpenConns(n int) {
@@ -116,53 +253,54 @@ func (dbx *DBX) NamedSelect(dest interface{}, query string, arg interface{}) err
 }
 
 func (dbx *DBX) NamedExec(query string, arg interface{}) (sql.Result, error) {
-	return namedExec(dbx, query, arg)
+	return namedExec(context.Background(), dbx, query, arg)
+}
+
+func (dbx *DBX) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	return namedExec(ctx, dbx, query, arg)
 }
 
+// NamedInsert generates the insert of target, a struct or a slice of structs, into tableName.
+// A nil paramNames inserts every db tagged field, except those tagged auto or default, eg. `db:"id,auto"`,
+// the fields of nested structs, and those tagged omitempty that are zero in every struct.
+// Only nil generates the columns, an empty []string{} is used as given.
 func (dbx *DBX) NamedInsert(target interface{}, tableName string, paramNames []string, m map[string]interface{}) (string, []interface{}, error) {
 	return namedInsert(target, tableName, paramNames, m)
 }
 
-func (dbx *DBX) getDB() Querier {
+func (dbx *DBX) getDB() sqlxQuerier {
 	return dbx.db
 }
 
-func (dbx *DBX) SkipLog() {
-	dbx.skipLog = true
+func (dbx *DBX) getObservers() observers {
+	return dbx.observers
 }
 
-func (dbx *DBX) logQuery(query string, execTime time.Duration, err error, args ...interface{}) error {
-	if dbx.logAsync == true {
-		go dbx.log(query, execTime, err, args...)
-		return nil
-	}
+func (dbx *DBX) getServer() *serverInfo {
+	return dbx.server
+}
 
-	return dbx.log(query, execTime, err, args...)
+func (dbx *DBX) driverName() string {
+	return dbx.driver
 }
 
-func (dbx *DBX) log(query string, execTime time.Duration, err error, args ...interface{}) error {
-	if dbx.skipLog == true {
-		dbx.skipLog = false
-		return nil
-	}
+func (dbx *DBX) inTx() bool {
+	return false
+}
 
-	if err != nil && dbx.errorLog != nil {
-		if err2 := logMsg(dbx.errorLog, LevelError, query, execTime, errors.WithStack(err), args...); err2 != nil {
-			return err2
-		}
-	}
+func (dbx *DBX) retryPolicy() RetryPolicy {
+	return dbx.retry
+}
 
-	if execTime >= dbx.slowLogMin && dbx.slowLog != nil {
-		if err3 := logMsg(dbx.slowLog, LevelSlowQuery, query, execTime, nil, args...); err3 != nil {
-			return err3
-		}
-	}
+func (dbx *DBX) SkipLog() {
+	dbx.skipLog = true
+}
 
-	if dbx.debugLog != nil {
-		if err4 := logMsg(dbx.debugLog, LevelDebug, query, execTime, nil, args...); err4 != nil {
-			return err4
-		}
+func (dbx *DBX) logQuery(query string, execTime time.Duration, err error, args ...interface{}) error {
+	if dbx.skipLog == true {
+		dbx.skipLog = false
+		return nil
 	}
 
-	return nil
+	return dbx.loggers.logQuery(query, execTime, err, false, args...)
 }
@@ -0,0 +1,113 @@
+package dbx
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuerierContext_Cancel(t *testing.T) {
+	statements := []struct {
+		name string
+		run  func(ctx context.Context, q QuerierContext) error
+	}{
+		{name: "QueryxContext", run: func(ctx context.Context, q QuerierContext) error {
+			_, err := q.QueryxContext(ctx, "select id from a")
+			return err
+		}},
+		{name: "QueryRowxContext", run: func(ctx context.Context, q QuerierContext) error {
+			var id int
+			return q.QueryRowxContext(ctx, "select id from a").Scan(&id)
+		}},
+		{name: "SelectContext", run: func(ctx context.Context, q QuerierContext) error {
+			var ids []int
+			return q.SelectContext(ctx, &ids, "select id from a")
+		}},
+		{name: "ExecContext", run: func(ctx context.Context, q QuerierContext) error {
+			_, err := q.ExecContext(ctx, "update a set b = 1")
+			return err
+		}},
+		{name: "NamedExecContext", run: func(ctx context.Context, q QuerierContext) error {
+			_, err := q.NamedExecContext(ctx, "update a set b = :b", map[string]interface{}{"b": 1})
+			return err
+		}},
+	}
+
+	for _, stmt := range statements {
+		t.Run(stmt.name, func(t *testing.T) {
+			db, fdb := newFakeDBX(PostgresDriver)
+			logs := &bytes.Buffer{}
+			db.SetLogger(LogError, logs)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// the statement is canceled while the driver runs it
+			fdb.wait = func(ctx context.Context) error {
+				cancel()
+				<-ctx.Done()
+				return ctx.Err()
+			}
+
+			err := stmt.run(ctx, db)
+			require.True(t, errors.Is(err, context.Canceled), err)
+			require.True(t, errors.Is(err, ErrQueryCanceled), err)
+			require.Contains(t, logs.String(), LevelCanceled)
+			require.NotContains(t, logs.String(), `"`+LevelError+`"`)
+
+			// and the same through a transaction
+			fdb.wait = nil
+			tx, err := db.BeginTxx(context.Background(), nil)
+			require.NoError(t, err)
+
+			txCtx, txCancel := context.WithCancel(context.Background())
+			fdb.wait = func(ctx context.Context) error {
+				txCancel()
+				<-ctx.Done()
+				return ctx.Err()
+			}
+
+			err = stmt.run(txCtx, tx)
+			require.True(t, errors.Is(err, context.Canceled), err)
+			require.NoError(t, tx.Rollback())
+		})
+	}
+}
+
+func TestDBX_BeginTxx(t *testing.T) {
+	db, fdb := newFakeDBX(PostgresDriver)
+
+	// the transaction is rolled back when its context is canceled before Commit
+	ctx, cancel := context.WithCancel(context.Background())
+	tx, err := db.BeginTxx(ctx, nil)
+	require.NoError(t, err)
+
+	_, err = tx.Exec("update a set b = 1")
+	require.NoError(t, err)
+
+	cancel()
+	require.True(t, errors.Is(tx.Commit(), context.Canceled))
+	require.Eventually(t, func() bool {
+		log := fdb.log()
+		return log[len(log)-1] == "ROLLBACK"
+	}, time.Second, time.Millisecond)
+
+	// an already canceled context fails to begin
+	_, err = db.BeginTxx(ctx, nil)
+	require.True(t, errors.Is(err, ErrQueryCanceled), err)
+
+	fdb.exec = func(query string, args []driver.NamedValue) (driver.Result, error) {
+		return driver.RowsAffected(1), nil
+	}
+	tx, err = db.BeginTxx(context.Background(), nil)
+	require.NoError(t, err)
+	_, err = tx.ExecContext(context.Background(), "update a set b = 2")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	require.Equal(t, "COMMIT", fdb.log()[len(fdb.log())-1])
+}
@@ -1,5 +1,18 @@
 package dbx
 
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
 type MissingParamErr struct {
 	error string
 }
@@ -31,3 +44,394 @@ type EmptySliceErr struct {
 func (e *EmptySliceErr) Error() string {
 	return e.error
 }
+
+// Error categories of the driver errors returned by dbx, to be matched with errors.Is.
+// errors.As with a *DBError gives the constraint, table and column when the driver reports them.
+var (
+	ErrUniqueViolation     = errors.New("dbx: unique violation")
+	ErrForeignKeyViolation = errors.New("dbx: foreign key violation")
+	ErrNotNullViolation    = errors.New("dbx: not null violation")
+	ErrCheckViolation      = errors.New("dbx: check violation")
+	ErrDeadlock            = errors.New("dbx: deadlock")
+	ErrSerialization       = errors.New("dbx: serialization failure")
+	ErrConnection          = errors.New("dbx: connection error")
+	ErrQueryCanceled       = errors.New("dbx: query canceled")
+)
+
+// DBError wraps a driver error with its category
+type DBError struct {
+	// Kind is one of the Err* categories
+	Kind error
+	Err  error
+
+	// Code is the SQLSTATE of postgres errors, the error number of mysql errors and the extended
+	// result code of sqlite errors
+	Code       string
+	Constraint string
+	Table      string
+	Column     string
+}
+
+func (e *DBError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DBError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the category of the error, errors.Is keeps matching the wrapped driver error through Unwrap
+func (e *DBError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// QueryError is returned when a statement fails. It wraps the error of the driver, classified by ClassifyError,
+// with the statement that failed.
+type QueryError struct {
+	Err error
+
+	// Query is the statement sent to the driver, after rebind and hooks
+	Query string
+
+	// Args holds the type of every argument, their values are left out so they don't leak in error reports
+	Args     []string
+	Duration time.Duration
+	Driver   string
+	InTx     bool
+}
+
+func newQueryError(querier dbxInternal, event *QueryEvent) *QueryError {
+	return &QueryError{
+		Err:      event.Err,
+		Query:    event.Query,
+		Args:     redactArgs(event.Args),
+		Duration: event.Duration,
+		Driver:   querier.driverName(),
+		InTx:     event.InTx,
+	}
+}
+
+func (e *QueryError) Error() string {
+	return e.Err.Error() + " (query: " + strings.TrimSpace(cleanQuery(e.Query)) + ")"
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// redactArgs replaces the arguments of a statement by their type
+func redactArgs(args []interface{}) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == nil {
+			redacted[i] = "nil"
+			continue
+		}
+
+		redacted[i] = reflect.TypeOf(arg).String()
+	}
+
+	return redacted
+}
+
+const (
+	pgUniqueViolation      = "23505"
+	pgForeignKeyViolation  = "23503"
+	pgNotNullViolation     = "23502"
+	pgCheckViolation       = "23514"
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+	pgQueryCanceled        = "57014"
+	pgAdminShutdown        = "57P01"
+	pgCrashShutdown        = "57P02"
+	pgCannotConnectNow     = "57P03"
+
+	mysqlDupEntry         = 1062
+	mysqlDupEntryKeyName  = 1586
+	mysqlNoReferencedRow  = 1216
+	mysqlRowIsReferenced  = 1217
+	mysqlRowIsReferenced2 = 1451
+	mysqlNoReferencedRow2 = 1452
+	mysqlBadNull          = 1048
+	mysqlCheckViolated    = 3819
+	mysqlDeadlock         = 1213
+	mysqlQueryInterrupted = 1317
+	mysqlMaxExecTime      = 3024
+	mysqlTooManyConns     = 1040
+	mysqlServerShutdown   = 1053
+
+	sqliteConstraintCheck      = 275
+	sqliteConstraintForeignKey = 787
+	sqliteConstraintNotNull    = 1299
+	sqliteConstraintPrimaryKey = 1555
+	sqliteConstraintUnique     = 2067
+	sqliteBusySnapshot         = 517
+	sqliteInterrupt            = 9
+	sqliteCantOpen             = 14
+)
+
+var (
+	regMysqlKey       = regexp.MustCompile("for key '([^']+)'")
+	regMysqlFK        = regexp.MustCompile("`([^`]+)`, CONSTRAINT `([^`]+)` FOREIGN KEY \\(`([^`]+)`\\)")
+	regMysqlColumn    = regexp.MustCompile("Column '([^']+)'")
+	regMysqlCheck     = regexp.MustCompile("[Cc]heck constraint '([^']+)'")
+	regSqliteColumns  = regexp.MustCompile(`constraint failed: ([\w.]+)`)
+	regSqliteCheck    = regexp.MustCompile(`CHECK constraint failed: (\w+)$`)
+	regSQLState       = regexp.MustCompile(`^[0-9A-Z]{5}$`)
+	regConnectionLost = regexp.MustCompile(`(?i)(bad connection|invalid connection|connection reset|broken pipe|connection refused|unexpected EOF)`)
+)
+
+// ClassifyError wraps err into a *DBError when it falls into one of the Err* categories, and returns it
+// unchanged otherwise. dbx classifies the errors of the statements it runs, use it on the errors returned
+// while iterating rows, eg. by Rows.Err.
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var dbErr *DBError
+	if errors.As(err, &dbErr) {
+		return err
+	}
+
+	if e := classifyDriverError(err); e != nil {
+		return e
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return &DBError{Kind: ErrQueryCanceled, Err: err}
+	case isConnectionError(err):
+		return &DBError{Kind: ErrConnection, Err: err}
+	}
+
+	return err
+}
+
+// classifyDriverError categorizes the postgres, mysql or sqlite error found in the chain of err. An error
+// carrying a code that isn't one of a driver, or falls in no category, doesn't stop the search.
+func classifyDriverError(err error) *DBError {
+	for e := err; e != nil; e = unwrapErr(e) {
+		if code := pgErrState(e); code != "" {
+			if dbErr := classifyPgError(err, e, code); dbErr != nil {
+				return dbErr
+			}
+		}
+
+		if number, ok := mysqlErrNumberOf(e); ok {
+			if dbErr := classifyMysqlError(err, number); dbErr != nil {
+				return dbErr
+			}
+		}
+
+		if f, ok := errField(e, "ExtendedCode"); ok && f.Kind() == reflect.Int {
+			if dbErr := classifySqliteError(err, int(f.Int())); dbErr != nil {
+				return dbErr
+			}
+		}
+	}
+
+	return nil
+}
+
+func classifyPgError(err error, pgErr error, code string) *DBError {
+	dbErr := &DBError{Err: err, Code: code}
+
+	switch {
+	case code == pgUniqueViolation:
+		dbErr.Kind = ErrUniqueViolation
+	case code == pgForeignKeyViolation:
+		dbErr.Kind = ErrForeignKeyViolation
+	case code == pgNotNullViolation:
+		dbErr.Kind = ErrNotNullViolation
+	case code == pgCheckViolation:
+		dbErr.Kind = ErrCheckViolation
+	case code == pgDeadlockDetected:
+		dbErr.Kind = ErrDeadlock
+	case code == pgSerializationFailure:
+		dbErr.Kind = ErrSerialization
+	case code == pgQueryCanceled:
+		dbErr.Kind = ErrQueryCanceled
+	case strings.HasPrefix(code, "08"), code == pgAdminShutdown, code == pgCrashShutdown, code == pgCannotConnectNow:
+		dbErr.Kind = ErrConnection
+	default:
+		return nil
+	}
+
+	// pgx names the fields ConstraintName, TableName and ColumnName, lib/pq Constraint, Table and Column
+	dbErr.Constraint = errStringField(pgErr, "ConstraintName", "Constraint")
+	dbErr.Table = errStringField(pgErr, "TableName", "Table")
+	dbErr.Column = errStringField(pgErr, "ColumnName", "Column")
+
+	return dbErr
+}
+
+func classifyMysqlError(err error, number int) *DBError {
+	dbErr := &DBError{Err: err, Code: strconv.Itoa(number)}
+	msg := err.Error()
+
+	switch number {
+	case mysqlDupEntry, mysqlDupEntryKeyName:
+		dbErr.Kind = ErrUniqueViolation
+		if m := regMysqlKey.FindStringSubmatch(msg); m != nil {
+			// mysql 8 qualifies the key with its table. eg. users.email
+			if i := strings.LastIndex(m[1], "."); i >= 0 {
+				dbErr.Table, dbErr.Constraint = m[1][:i], m[1][i+1:]
+			} else {
+				dbErr.Constraint = m[1]
+			}
+		}
+	case mysqlNoReferencedRow, mysqlRowIsReferenced, mysqlRowIsReferenced2, mysqlNoReferencedRow2:
+		dbErr.Kind = ErrForeignKeyViolation
+		if m := regMysqlFK.FindStringSubmatch(msg); m != nil {
+			dbErr.Table, dbErr.Constraint, dbErr.Column = m[1], m[2], m[3]
+		}
+	case mysqlBadNull:
+		dbErr.Kind = ErrNotNullViolation
+		if m := regMysqlColumn.FindStringSubmatch(msg); m != nil {
+			dbErr.Column = m[1]
+		}
+	case mysqlCheckViolated:
+		dbErr.Kind = ErrCheckViolation
+		if m := regMysqlCheck.FindStringSubmatch(msg); m != nil {
+			dbErr.Constraint = m[1]
+		}
+	case mysqlDeadlock:
+		dbErr.Kind = ErrDeadlock
+	case mysqlQueryInterrupted, mysqlMaxExecTime:
+		dbErr.Kind = ErrQueryCanceled
+	case mysqlTooManyConns, mysqlServerShutdown:
+		dbErr.Kind = ErrConnection
+	default:
+		return nil
+	}
+
+	return dbErr
+}
+
+func classifySqliteError(err error, code int) *DBError {
+	dbErr := &DBError{Err: err, Code: strconv.Itoa(code)}
+	msg := err.Error()
+
+	switch code {
+	case sqliteConstraintUnique, sqliteConstraintPrimaryKey:
+		dbErr.Kind = ErrUniqueViolation
+	case sqliteConstraintForeignKey:
+		dbErr.Kind = ErrForeignKeyViolation
+	case sqliteConstraintNotNull:
+		dbErr.Kind = ErrNotNullViolation
+	case sqliteConstraintCheck:
+		dbErr.Kind = ErrCheckViolation
+		if m := regSqliteCheck.FindStringSubmatch(msg); m != nil {
+			dbErr.Constraint = m[1]
+		}
+		return dbErr
+	case sqliteBusySnapshot:
+		dbErr.Kind = ErrSerialization
+	case sqliteInterrupt:
+		dbErr.Kind = ErrQueryCanceled
+	case sqliteCantOpen:
+		dbErr.Kind = ErrConnection
+	default:
+		return nil
+	}
+
+	// eg. UNIQUE constraint failed: users.email
+	if m := regSqliteColumns.FindStringSubmatch(msg); m != nil {
+		if i := strings.Index(m[1], "."); i >= 0 {
+			dbErr.Table, dbErr.Column = m[1][:i], m[1][i+1:]
+		}
+	}
+
+	return dbErr
+}
+
+// isConnectionError tells whether err means the connection to the database was lost or refused
+func isConnectionError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return regConnectionLost.MatchString(err.Error())
+}
+
+// pgErrState returns the SQLSTATE carried by a postgres driver error (pgx, lib/pq), or an empty string
+func pgErrState(err error) string {
+	var code string
+	if s, ok := err.(interface{ SQLState() string }); ok {
+		code = s.SQLState()
+	} else if f, ok := errField(err, "Code"); ok && f.Kind() == reflect.String {
+		code = f.String()
+	}
+
+	if !regSQLState.MatchString(code) {
+		return ""
+	}
+
+	return code
+}
+
+func mysqlErrNumberOf(err error) (int, bool) {
+	if f, ok := errField(err, "Number"); ok && f.Kind() == reflect.Uint16 {
+		return int(f.Uint()), true
+	}
+
+	return 0, false
+}
+
+// isTxConflict reports whether err means the transaction lost a serialization or deadlock race
+// and may succeed if run again
+func isTxConflict(err error) bool {
+	err = ClassifyError(err)
+	return errors.Is(err, ErrDeadlock) || errors.Is(err, ErrSerialization)
+}
+
+// errStringField returns the first of the named string fields set on a driver error struct
+func errStringField(err error, names ...string) string {
+	for _, name := range names {
+		if f, ok := errField(err, name); ok && f.Kind() == reflect.String && f.String() != "" {
+			return f.String()
+		}
+	}
+
+	return ""
+}
+
+// errField looks up an exported field on a driver error struct without importing the driver
+func errField(err error, name string) (reflect.Value, bool) {
+	v := reflect.ValueOf(err)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+
+	f := v.FieldByName(name)
+	if !f.IsValid() {
+		return reflect.Value{}, false
+	}
+
+	return f, true
+}
+
+func unwrapErr(err error) error {
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		return e.Unwrap()
+	case interface{ Cause() error }:
+		return e.Cause()
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package dbx
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePgxError has the fields of pgx's PgError
+type fakePgxError struct {
+	Code           string
+	ConstraintName string
+	TableName      string
+	ColumnName     string
+}
+
+func (e *fakePgxError) Error() string {
+	return "ERROR: " + e.Code
+}
+
+func (e *fakePgxError) SQLState() string {
+	return e.Code
+}
+
+// fakePqError has the fields of lib/pq's Error
+type fakePqError struct {
+	Code       string
+	Constraint string
+	Table      string
+	Column     string
+}
+
+func (e *fakePqError) Error() string {
+	return "pq: " + e.Code
+}
+
+// fakeSqliteError has the fields of go-sqlite3's Error
+type fakeSqliteError struct {
+	Code         int
+	ExtendedCode int
+	msg          string
+}
+
+func (e fakeSqliteError) Error() string {
+	return e.msg
+}
+
+// codedError wraps an error with a code of its own, like the errors of an application or an RPC framework
+type codedError struct {
+	Code string
+	err  error
+}
+
+func (e *codedError) Error() string {
+	return e.Code + ": " + e.err.Error()
+}
+
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+func Test_ClassifyError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected *DBError
+	}{
+		{
+			name:     "pgx unique violation",
+			err:      &fakePgxError{Code: "23505", ConstraintName: "users_email_key", TableName: "users"},
+			expected: &DBError{Kind: ErrUniqueViolation, Code: "23505", Constraint: "users_email_key", Table: "users"},
+		},
+		{
+			name:     "wrapper with a code that isn't a SQLSTATE",
+			err:      &codedError{Code: "INVALID_ARGUMENT", err: &fakePqError{Code: "23505", Constraint: "users_email_key"}},
+			expected: &DBError{Kind: ErrUniqueViolation, Code: "23505", Constraint: "users_email_key"},
+		},
+		{
+			name:     "wrapper with a code in no category",
+			err:      &codedError{Code: "42601", err: &fakePgxError{Code: "40001"}},
+			expected: &DBError{Kind: ErrSerialization, Code: "40001"},
+		},
+		{
+			name:     "lib/pq foreign key violation",
+			err:      &fakePqError{Code: "23503", Constraint: "orders_user_id_fkey", Table: "orders"},
+			expected: &DBError{Kind: ErrForeignKeyViolation, Code: "23503", Constraint: "orders_user_id_fkey", Table: "orders"},
+		},
+		{
+			name:     "postgres not null violation",
+			err:      &fakePgxError{Code: "23502", TableName: "users", ColumnName: "name"},
+			expected: &DBError{Kind: ErrNotNullViolation, Code: "23502", Table: "users", Column: "name"},
+		},
+		{
+			name:     "postgres check violation",
+			err:      &fakePqError{Code: "23514", Constraint: "age_positive"},
+			expected: &DBError{Kind: ErrCheckViolation, Code: "23514", Constraint: "age_positive"},
+		},
+		{name: "postgres deadlock", err: &fakePgError{Code: "40P01"}, expected: &DBError{Kind: ErrDeadlock, Code: "40P01"}},
+		{name: "postgres serialization failure", err: &fakePgError{Code: "40001"}, expected: &DBError{Kind: ErrSerialization, Code: "40001"}},
+		{name: "postgres query canceled", err: &fakePgError{Code: "57014"}, expected: &DBError{Kind: ErrQueryCanceled, Code: "57014"}},
+		{name: "postgres connection failure", err: &fakePgError{Code: "08006"}, expected: &DBError{Kind: ErrConnection, Code: "08006"}},
+		{name: "postgres admin shutdown", err: &fakePgError{Code: "57P01"}, expected: &DBError{Kind: ErrConnection, Code: "57P01"}},
+		{
+			name:     "mysql 8 duplicate entry",
+			err:      &fakeMysqlError{Number: 1062, Message: "Error 1062: Duplicate entry 'a@b.c' for key 'users.email'"},
+			expected: &DBError{Kind: ErrUniqueViolation, Code: "1062", Table: "users", Constraint: "email"},
+		},
+		{
+			name:     "mysql 5 duplicate entry",
+			err:      &fakeMysqlError{Number: 1062, Message: "Error 1062: Duplicate entry 'a@b.c' for key 'email'"},
+			expected: &DBError{Kind: ErrUniqueViolation, Code: "1062", Constraint: "email"},
+		},
+		{
+			name:     "mysql foreign key violation",
+			err:      &fakeMysqlError{Number: 1452, Message: "Error 1452: Cannot add or update a child row: a foreign key constraint fails (`app`.`orders`, CONSTRAINT `fk_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`))"},
+			expected: &DBError{Kind: ErrForeignKeyViolation, Code: "1452", Table: "orders", Constraint: "fk_user", Column: "user_id"},
+		},
+		{
+			name:     "mysql not null violation",
+			err:      &fakeMysqlError{Number: 1048, Message: "Error 1048: Column 'name' cannot be null"},
+			expected: &DBError{Kind: ErrNotNullViolation, Code: "1048", Column: "name"},
+		},
+		{
+			name:     "mysql check violation",
+			err:      &fakeMysqlError{Number: 3819, Message: "Error 3819: Check constraint 'age_positive' is violated."},
+			expected: &DBError{Kind: ErrCheckViolation, Code: "3819", Constraint: "age_positive"},
+		},
+		{name: "mysql deadlock", err: &fakeMysqlError{Number: 1213, Message: "Deadlock found"}, expected: &DBError{Kind: ErrDeadlock, Code: "1213"}},
+		{name: "mysql query interrupted", err: &fakeMysqlError{Number: 1317, Message: "Query execution was interrupted"}, expected: &DBError{Kind: ErrQueryCanceled, Code: "1317"}},
+		{
+			name:     "sqlite unique violation",
+			err:      fakeSqliteError{Code: 19, ExtendedCode: 2067, msg: "UNIQUE constraint failed: users.email"},
+			expected: &DBError{Kind: ErrUniqueViolation, Code: "2067", Table: "users", Column: "email"},
+		},
+		{
+			name:     "sqlite not null violation",
+			err:      fakeSqliteError{Code: 19, ExtendedCode: 1299, msg: "NOT NULL constraint failed: users.name"},
+			expected: &DBError{Kind: ErrNotNullViolation, Code: "1299", Table: "users", Column: "name"},
+		},
+		{
+			name:     "sqlite check violation",
+			err:      fakeSqliteError{Code: 19, ExtendedCode: 275, msg: "CHECK constraint failed: age_positive"},
+			expected: &DBError{Kind: ErrCheckViolation, Code: "275", Constraint: "age_positive"},
+		},
+		{name: "sqlite foreign key violation", err: fakeSqliteError{Code: 19, ExtendedCode: 787, msg: "FOREIGN KEY constraint failed"}, expected: &DBError{Kind: ErrForeignKeyViolation, Code: "787"}},
+		{name: "context canceled", err: context.Canceled, expected: &DBError{Kind: ErrQueryCanceled}},
+		{name: "bad connection", err: driver.ErrBadConn, expected: &DBError{Kind: ErrConnection}},
+		{name: "network error", err: &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, expected: &DBError{Kind: ErrConnection}},
+		{name: "mysql invalid connection", err: errors.New("invalid connection"), expected: &DBError{Kind: ErrConnection}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ClassifyError(fmt.Errorf("exec: %w", test.err))
+			require.True(t, errors.Is(err, test.expected.Kind))
+			require.True(t, errors.Is(err, test.err))
+
+			var dbErr *DBError
+			require.True(t, errors.As(err, &dbErr))
+
+			test.expected.Err = dbErr.Err
+			require.Equal(t, test.expected, dbErr)
+			require.Equal(t, "exec: "+test.err.Error(), err.Error())
+		})
+	}
+}
+
+func Test_ClassifyError_Unclassified(t *testing.T) {
+	require.Nil(t, ClassifyError(nil))
+
+	err := errors.New("syntax error")
+	require.Equal(t, err, ClassifyError(err))
+
+	pgErr := &fakePgError{Code: "42601"}
+	require.Equal(t, pgErr, ClassifyError(pgErr))
+
+	classified := ClassifyError(&fakePgError{Code: "23505"})
+	require.True(t, classified == ClassifyError(classified))
+}
+
+func Test_Exec_ClassifiesErrors(t *testing.T) {
+	dbx, fdb := newFakeDBX(PostgresDriver)
+	fdb.exec = func(query string, args []driver.NamedValue) (driver.Result, error) {
+		return nil, &fakePgxError{Code: "23505", ConstraintName: "users_email_key"}
+	}
+	fdb.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+		return nil, &fakePgxError{Code: "23503", ConstraintName: "orders_user_id_fkey"}
+	}
+
+	_, err := dbx.Exec("Insert Into users (email) Values (?)", "a@b.c")
+	require.True(t, errors.Is(err, ErrUniqueViolation))
+
+	var dbErr *DBError
+	require.True(t, errors.As(err, &dbErr))
+	require.Equal(t, "users_email_key", dbErr.Constraint)
+
+	var id int
+	err = dbx.QueryRowx("Insert Into orders (user_id) Values (?) Returning id", 1).Scan(&id)
+	require.True(t, errors.Is(err, ErrForeignKeyViolation))
+}
+
+func Test_QueryError(t *testing.T) {
+	dbx, fdb := newFakeDBX(PostgresDriver)
+	driverErr := &fakePgxError{Code: "23505", ConstraintName: "users_email_key"}
+	fdb.exec = func(query string, args []driver.NamedValue) (driver.Result, error) {
+		return nil, driverErr
+	}
+
+	_, err := dbx.Exec("Insert Into users (email, age, note) Values (?, ?, ?)", "a@b.c", 42, nil)
+
+	var queryErr *QueryError
+	require.True(t, errors.As(err, &queryErr))
+	require.Equal(t, "Insert Into users (email, age, note) Values ($1, $2, $3)", queryErr.Query)
+	require.Equal(t, []string{"string", "int", "nil"}, queryErr.Args)
+	require.Equal(t, PostgresDriver, queryErr.Driver)
+	require.False(t, queryErr.InTx)
+	require.NotContains(t, err.Error(), "a@b.c")
+	require.Equal(t, "ERROR: 23505 (query: Insert Into users (email, age, note) Values ($1, $2, $3))", err.Error())
+
+	require.True(t, errors.Is(err, ErrUniqueViolation))
+	require.True(t, errors.Is(err, driverErr))
+
+	err = dbx.RunInTx(context.Background(), nil, func(tx *Tx) error {
+		_, err := tx.Exec("Update users Set email = ?", "a@b.c")
+		return err
+	})
+	require.True(t, errors.As(err, &queryErr))
+	require.True(t, queryErr.InTx)
+	require.Equal(t, "Update users Set email = $1", queryErr.Query)
+}
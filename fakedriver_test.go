@@ -0,0 +1,158 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeDB is an in-memory database/sql driver recording every statement it receives.
+// exec and query let a test script the results; by default statements succeed and return no rows.
+type fakeDB struct {
+	mu         sync.Mutex
+	statements []string
+
+	exec  func(query string, args []driver.NamedValue) (driver.Result, error)
+	query func(query string, args []driver.NamedValue) (driver.Rows, error)
+	ping  func() error
+
+	// wait runs while a statement executes, eg. to cancel its context mid-query
+	wait func(ctx context.Context) error
+}
+
+func newFakeDBX(driverName string) (*DBX, *fakeDB) {
+	fdb := &fakeDB{}
+	db := sqlx.NewDb(sql.OpenDB(fdb), driverName)
+
+	return &DBX{db: db, driver: driverName, server: &serverInfo{}}, fdb
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{f}, nil
+}
+
+func (f *fakeDB) Driver() driver.Driver {
+	return nil
+}
+
+func (f *fakeDB) record(stmt string) {
+	f.mu.Lock()
+	f.statements = append(f.statements, stmt)
+	f.mu.Unlock()
+}
+
+func (f *fakeDB) log() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.statements...)
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	if c.db.ping != nil {
+		return c.db.ping()
+	}
+
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.db.record("BEGIN")
+	return &fakeTx{c.db}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.db.record(query)
+	if c.db.wait != nil {
+		if err := c.db.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.db.exec != nil {
+		return c.db.exec(query, args)
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.db.record(query)
+	if c.db.wait != nil {
+		if err := c.db.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.db.query != nil {
+		return c.db.query(query, args)
+	}
+
+	return &fakeRows{}, nil
+}
+
+type fakeTx struct {
+	db *fakeDB
+}
+
+func (t *fakeTx) Commit() error {
+	t.db.record("COMMIT")
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	t.db.record("ROLLBACK")
+	return nil
+}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.cols
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package dbx
+
+import (
+	"context"
+	"time"
+)
+
+// QueryEvent describes a single statement run through DBX or Tx.
+// Query holds the statement after it has been rebinded for the driver.
+type QueryEvent struct {
+	Query string
+	Args  []interface{}
+	InTx  bool
+
+	// Start, Duration and Err are set once the statement has run, and can be read in Hook.After
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+
+	// RowsAffected is set after a successful Exec or NamedExec, and is -1 otherwise
+	RowsAffected int64
+}
+
+// Hook lets callers act before and after every statement.
+// Before may rewrite the event's Query and Args, or return an error to prevent the statement from running.
+// After is called for every hook whose Before returned nil, in reverse order of registration.
+type Hook interface {
+	Before(ctx context.Context, event *QueryEvent) error
+	After(ctx context.Context, event *QueryEvent)
+}
+
+// AddHook registers hooks run around every statement. Transactions started afterwards inherit them.
+func (dbx *DBX) AddHook(hooks ...Hook) {
+	dbx.hooks = append(dbx.hooks, hooks...)
+}
+
+func runBeforeHooks(ctx context.Context, hooks []Hook, event *QueryEvent) (int, error) {
+	for i, h := range hooks {
+		if err := h.Before(ctx, event); err != nil {
+			return i, err
+		}
+	}
+
+	return len(hooks), nil
+}
+
+func runAfterHooks(ctx context.Context, hooks []Hook, event *QueryEvent) {
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i].After(ctx, event)
+	}
+}
@@ -0,0 +1,88 @@
+package dbx
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingHook struct {
+	name    string
+	calls   *[]string
+	reject  error
+	comment string
+}
+
+func (h *recordingHook) Before(ctx context.Context, event *QueryEvent) error {
+	*h.calls = append(*h.calls, h.name+".before")
+	if h.comment != "" {
+		event.Query = "/* " + h.comment + " */ " + event.Query
+	}
+
+	return h.reject
+}
+
+func (h *recordingHook) After(ctx context.Context, event *QueryEvent) {
+	*h.calls = append(*h.calls, h.name+".after")
+}
+
+func TestHooks(t *testing.T) {
+	db, fdb := newFakeDBX(PostgresDriver)
+
+	calls := []string{}
+	db.AddHook(
+		&recordingHook{name: "a", calls: &calls, comment: "req-1"},
+		&recordingHook{name: "b", calls: &calls},
+	)
+
+	_, err := db.Exec("update a set b = ? where c = ?", 1, 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.before", "b.before", "b.after", "a.after"}, calls)
+	require.Equal(t, []string{"/* req-1 */ update a set b = $1 where c = $2"}, fdb.log())
+
+	// transactions inherit the hooks
+	calls = calls[:0]
+	tx := db.MustBegin()
+	require.NoError(t, tx.Select(&[]int{}, "select 1"))
+	require.NoError(t, tx.Commit())
+	require.Equal(t, []string{"a.before", "b.before", "b.after", "a.after"}, calls)
+}
+
+func TestHooks_Reject(t *testing.T) {
+	db, fdb := newFakeDBX(PostgresDriver)
+
+	calls := []string{}
+	rejected := errors.New("maintenance mode")
+	db.AddHook(
+		&recordingHook{name: "a", calls: &calls},
+		&recordingHook{name: "b", calls: &calls, reject: rejected},
+		&recordingHook{name: "c", calls: &calls},
+	)
+
+	_, err := db.Exec("delete from a")
+	require.Equal(t, rejected, err)
+	require.Equal(t, []string{"a.before", "b.before", "a.after"}, calls)
+
+	var id int
+	require.Equal(t, rejected, db.QueryRowx("select id from a").Scan(&id))
+	require.Empty(t, fdb.log())
+
+	// a rejected statement didn't run, it's logged as an error but never as slow
+	errLog, slowLog := &bytes.Buffer{}, &bytes.Buffer{}
+	db.SetLogger(LogError, errLog)
+	db.SetLogger(LogSLow, slowLog)
+	db.SetSlowLogMin(0)
+
+	_, err = db.ExecContext(context.Background(), "delete from a")
+	require.Equal(t, rejected, err)
+	require.Contains(t, errLog.String(), "maintenance mode")
+	require.Empty(t, slowLog.String())
+
+	// a canceled context doesn't hide the rejection of a QueryRowx
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, rejected, db.QueryRowxContext(ctx, "select id from a").Scan(&id))
+}
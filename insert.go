@@ -0,0 +1,455 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// Bind parameter limits per statement
+const (
+	pgMaxPlaceholders     = 65535
+	mysqlMaxPlaceholders  = 65535
+	sqliteMaxPlaceholders = 32766
+)
+
+// DefaultMysqlMaxBatchBytes caps the values of a mysql batch below the 4MB max_allowed_packet default
+// of mysql 5.7, leaving room for the statement itself
+const DefaultMysqlMaxBatchBytes = 3 << 20
+
+// BulkInsertOption controls how a slice of structs is split into several insert statements
+type BulkInsertOption struct {
+	// BatchSize caps the number of rows per statement. When 0, batches are as large as the driver's
+	// bind parameter limit allows.
+	BatchSize int
+
+	// MaxBatchBytes caps the estimated size of the values sent in one statement. When 0, mysql batches
+	// are capped at DefaultMysqlMaxBatchBytes to fit in max_allowed_packet, the others aren't.
+	MaxBatchBytes int
+
+	// SingleTx runs every batch in one transaction, so that either all rows or none are inserted.
+	// The transaction isn't retried on conflicts, unlike RunInTx.
+	SingleTx bool
+}
+
+// InsertStructs inserts target, a struct or a slice of structs, into tableName and returns the result.
+// columns and overrides have the same meaning as in NamedInsert.
+// Slices too large for a single statement are inserted in batches, see BulkInsert.
+func (dbx *DBX) InsertStructs(ctx context.Context, tableName string, target interface{}, columns []string, overrides map[string]interface{}) (sql.Result, error) {
+	return insertStructs(ctx, dbx, tableName, target, columns, overrides, BulkInsertOption{})
+}
+
+// BulkInsert inserts a slice of structs in as many statements as needed to stay under the driver's
+// bind parameter limit, or under opt.BatchSize rows per statement.
+// The returned result reports the rows inserted across all batches.
+func (dbx *DBX) BulkInsert(ctx context.Context, tableName string, target interface{}, columns []string, overrides map[string]interface{}, opt BulkInsertOption) (sql.Result, error) {
+	if !opt.SingleTx {
+		return insertStructs(ctx, dbx, tableName, target, columns, overrides, opt)
+	}
+
+	// a plain transaction, RunInTx would replay the whole import on a conflict
+	tx, err := dbx.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := insertStructs(ctx, tx, tableName, target, columns, overrides, opt)
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			dbx.logEvent(LevelError, "rollback failed", rbErr)
+		}
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// InsertStructsReturning inserts target like InsertStructs, and scans the returning columns of every
+// inserted row back into target, which must be a pointer to a struct, a slice of structs or a slice of
+// struct pointers. A nil returning scans the full rows back.
+// On mysql only the generated id of a single struct can be scanned back.
+func (dbx *DBX) InsertStructsReturning(ctx context.Context, tableName string, target interface{}, columns []string, overrides map[string]interface{}, returning []string) error {
+	return insertStructsReturning(ctx, dbx, tableName, target, columns, overrides, returning)
+}
+
+func (tx *Tx) InsertStructs(ctx context.Context, tableName string, target interface{}, columns []string, overrides map[string]interface{}) (sql.Result, error) {
+	return insertStructs(ctx, tx, tableName, target, columns, overrides, BulkInsertOption{})
+}
+
+// BulkInsert inserts a slice of structs in batches inside the transaction, opt.SingleTx is implied
+func (tx *Tx) BulkInsert(ctx context.Context, tableName string, target interface{}, columns []string, overrides map[string]interface{}, opt BulkInsertOption) (sql.Result, error) {
+	return insertStructs(ctx, tx, tableName, target, columns, overrides, opt)
+}
+
+func (tx *Tx) InsertStructsReturning(ctx context.Context, tableName string, target interface{}, columns []string, overrides map[string]interface{}, returning []string) error {
+	return insertStructsReturning(ctx, tx, tableName, target, columns, overrides, returning)
+}
+
+// bulkResult adds up the results of every batch of an insert
+type bulkResult struct {
+	rowsAffected int64
+	lastInsertID int64
+	idErr        error
+}
+
+func (r *bulkResult) LastInsertId() (int64, error) {
+	return r.lastInsertID, r.idErr
+}
+
+func (r *bulkResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+func (r *bulkResult) add(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	r.rowsAffected += affected
+	r.lastInsertID, r.idErr = res.LastInsertId()
+
+	return nil
+}
+
+func insertStructs(ctx context.Context, querier dbxInternal, tableName string, target interface{}, columns []string, overrides map[string]interface{}, opt BulkInsertOption) (sql.Result, error) {
+	columns, err := insertColumns(target, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	batchSize := rowsPerBatch(querier.driverName(), len(columns), opt.BatchSize)
+
+	maxBytes := opt.MaxBatchBytes
+	if maxBytes == 0 && querier.driverName() == MysqlDriver {
+		maxBytes = DefaultMysqlMaxBatchBytes
+	}
+
+	batches := splitInsertTarget(target, batchSize)
+	if maxBytes > 0 {
+		batches, err = splitInsertTargetBySize(target, columns, overrides, batchSize, maxBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(batches) == 1 {
+		query, args, err := namedInsert(target, tableName, columns, copyValueMapper(overrides))
+		if err != nil {
+			return nil, err
+		}
+
+		return exec(ctx, querier, query, args...)
+	}
+
+	total := &bulkResult{}
+	for _, batch := range batches {
+		query, args, err := namedInsert(batch, tableName, columns, copyValueMapper(overrides))
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := exec(ctx, querier, query, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := total.add(res); err != nil {
+			return nil, err
+		}
+	}
+
+	return total, nil
+}
+
+func insertStructsReturning(ctx context.Context, querier dbxInternal, tableName string, target interface{}, columns []string, overrides map[string]interface{}, returning []string) error {
+	items, err := addressableItems(target)
+	if err != nil {
+		return err
+	}
+
+	columns, err = insertColumns(target, columns)
+	if err != nil {
+		return err
+	}
+
+	if querier.driverName() == MysqlDriver {
+		return insertStructsLastID(ctx, querier, tableName, target, items, columns, overrides, returning)
+	}
+
+	batchSize := rowsPerBatch(querier.driverName(), len(columns), 0)
+
+	for offset, batch := range splitInsertTarget(target, batchSize) {
+		query, args, err := namedInsert(batch, tableName, columns, copyValueMapper(overrides))
+		if err != nil {
+			return err
+		}
+
+		if len(returning) == 0 {
+			query = ReturningAll(query)
+		} else {
+			query = ReturningCustom(query, returning)
+		}
+
+		end := (offset + 1) * batchSize
+		if end > len(items) {
+			end = len(items)
+		}
+
+		if err := scanReturning(ctx, querier, query, args, items[offset*batchSize:end]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanReturning scans the rows returned by an insert into items, in the order of its Values
+func scanReturning(ctx context.Context, querier dbxInternal, query string, args []interface{}, items []reflect.Value) error {
+	rows, err := queryX(ctx, querier, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	scanned := 0
+	for ; rows.Next(); scanned++ {
+		if scanned >= len(items) {
+			return fmt.Errorf("insert returned more rows than the %d inserted", len(items))
+		}
+
+		if err := rows.StructScan(items[scanned].Addr().Interface()); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return ClassifyError(err)
+	}
+
+	if scanned < len(items) {
+		return fmt.Errorf("insert returned %d rows for the %d inserted", scanned, len(items))
+	}
+
+	return nil
+}
+
+// insertStructsLastID emulates Returning on mysql, which can only report the id generated for the first row
+func insertStructsLastID(ctx context.Context, querier dbxInternal, tableName string, target interface{}, items []reflect.Value, columns []string, overrides map[string]interface{}, returning []string) error {
+	if len(items) != 1 || len(returning) != 1 {
+		return &WrongTypeErr{fmt.Sprintf("driver %s only supports returning the generated id of a single row", MysqlDriver)}
+	}
+
+	res, err := insertStructs(ctx, querier, tableName, target, columns, overrides, BulkInsertOption{})
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	field, err := fieldByColumn(items[0], returning[0])
+	if err != nil {
+		return err
+	}
+
+	if !field.CanSet() {
+		return &WrongTypeErr{fmt.Sprintf("field for column '%s' can't be set", returning[0])}
+	}
+
+	idValue := reflect.ValueOf(id)
+	if !idValue.Type().ConvertibleTo(field.Type()) {
+		return &WrongTypeErr{fmt.Sprintf("can't scan generated id into field of type %s", field.Type())}
+	}
+
+	field.Set(idValue.Convert(field.Type()))
+	return nil
+}
+
+// maxPlaceholders returns the number of bind parameters the driver accepts in a single statement
+func maxPlaceholders(driver string) int {
+	switch driver {
+	case MysqlDriver:
+		return mysqlMaxPlaceholders
+	case Sqlite3Driver:
+		return sqliteMaxPlaceholders
+	}
+
+	return pgMaxPlaceholders
+}
+
+// rowsPerBatch returns how many rows of numColumns values fit in one statement
+func rowsPerBatch(driver string, numColumns int, batchSize int) int {
+	if numColumns < 1 {
+		numColumns = 1
+	}
+
+	max := maxPlaceholders(driver) / numColumns
+	if batchSize > 0 && batchSize < max {
+		return batchSize
+	}
+
+	if max < 1 {
+		return 1
+	}
+
+	return max
+}
+
+// splitInsertTarget splits a slice target into slices of at most batchSize items.
+// Any other target is returned as the only batch.
+func splitInsertTarget(target interface{}, batchSize int) []interface{} {
+	value := reflect.ValueOf(target)
+	if value.Kind() == reflect.Ptr && !value.IsNil() && value.Elem().Kind() == reflect.Slice {
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Slice || value.Len() <= batchSize {
+		return []interface{}{target}
+	}
+
+	var batches []interface{}
+	for start := 0; start < value.Len(); start += batchSize {
+		end := start + batchSize
+		if end > value.Len() {
+			end = value.Len()
+		}
+
+		batches = append(batches, value.Slice(start, end).Interface())
+	}
+
+	return batches
+}
+
+// splitInsertTargetBySize splits a slice target into slices of at most batchSize items, whose values
+// add up to at most maxBytes, as estimated by argSize. Any other target is returned as the only batch.
+func splitInsertTargetBySize(target interface{}, columns []string, overrides map[string]interface{}, batchSize int, maxBytes int) ([]interface{}, error) {
+	value := reflect.ValueOf(target)
+	if value.Kind() == reflect.Ptr && !value.IsNil() && value.Elem().Kind() == reflect.Slice {
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Slice {
+		return []interface{}{target}, nil
+	}
+
+	var batches []interface{}
+	start, size := 0, 0
+
+	for i := 0; i < value.Len(); i++ {
+		values, err := structParamValues(value.Index(i).Interface(), columns, overrides)
+		if err != nil {
+			return nil, err
+		}
+
+		rowSize := 0
+		for _, v := range values {
+			rowSize += argSize(v)
+		}
+
+		if i > start && (i-start >= batchSize || size+rowSize > maxBytes) {
+			batches = append(batches, value.Slice(start, i).Interface())
+			start, size = i, 0
+		}
+
+		size += rowSize
+	}
+
+	if value.Len() > start || len(batches) == 0 {
+		batches = append(batches, value.Slice(start, value.Len()).Interface())
+	}
+
+	return batches, nil
+}
+
+// argSize estimates the number of bytes an argument takes on the wire
+func argSize(arg interface{}) int {
+	v := reflect.Indirect(reflect.ValueOf(arg))
+
+	switch {
+	case !v.IsValid():
+		return 1
+	case v.Kind() == reflect.String:
+		return v.Len()
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return v.Len()
+	}
+
+	return 8
+}
+
+// copyValueMapper copies the overrides so that the params generated for a batch don't leak into the next one
+func copyValueMapper(m map[string]interface{}) map[string]interface{} {
+	cp := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+
+	return cp
+}
+
+// addressableItems returns the structs held by target so they can be scanned into
+func addressableItems(target interface{}) ([]reflect.Value, error) {
+	value := reflect.ValueOf(target)
+
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil, &NilPointerErr{"nil pointer passed as target"}
+		}
+
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		if !value.CanAddr() {
+			return nil, &WrongTypeErr{"target struct must be passed by pointer"}
+		}
+
+		return []reflect.Value{value}, nil
+	case reflect.Slice:
+		items := make([]reflect.Value, value.Len())
+		for i := range items {
+			item := value.Index(i)
+			if item.Kind() == reflect.Ptr {
+				if item.IsNil() {
+					return nil, &NilPointerErr{"nil pointer in target slice"}
+				}
+
+				item = item.Elem()
+			}
+
+			if item.Kind() != reflect.Struct {
+				return nil, &WrongTypeErr{"not a struct"}
+			}
+
+			items[i] = item
+		}
+
+		return items, nil
+	}
+
+	return nil, &WrongTypeErr{"target type not accepted"}
+}
+
+// fieldByColumn returns the field of a struct value mapped to column, by db tag or by field name
+func fieldByColumn(value reflect.Value, column string) (reflect.Value, error) {
+	meta, err := typeMetadata("db", value.Type())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	index, ok := meta.fieldIndex(column)
+	if !ok {
+		return reflect.Value{}, &MissingParamErr{error: fmt.Sprintf("param '%s' not found", column)}
+	}
+
+	return fieldByIndexAlloc(value, index), nil
+}
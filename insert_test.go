@@ -0,0 +1,193 @@
+package dbx
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type insertPerson struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func TestDBX_InsertStructs(t *testing.T) {
+	db, fdb := newFakeDBX(PostgresDriver)
+
+	var gotArgs []driver.NamedValue
+	fdb.exec = func(query string, args []driver.NamedValue) (driver.Result, error) {
+		gotArgs = args
+		return driver.RowsAffected(2), nil
+	}
+
+	people := []insertPerson{{Name: "Alpha"}, {Name: "Beta"}}
+	res, err := db.InsertStructs(context.Background(), "person", people, []string{"name"}, nil)
+	require.NoError(t, err)
+
+	affected, err := res.RowsAffected()
+	require.NoError(t, err)
+	require.EqualValues(t, 2, affected)
+	require.Equal(t, []string{"Insert into person (name) Values ($1),($2)"}, fdb.log())
+	require.Len(t, gotArgs, 2)
+	require.Equal(t, "Beta", gotArgs[1].Value)
+}
+
+func TestDBX_InsertStructsReturning(t *testing.T) {
+	db, fdb := newFakeDBX(PostgresDriver)
+
+	fdb.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+		return &fakeRows{cols: []string{"id"}, rows: [][]driver.Value{{int64(7)}, {int64(8)}}}, nil
+	}
+
+	people := []insertPerson{{Name: "Alpha"}, {Name: "Beta"}}
+	err := db.InsertStructsReturning(context.Background(), "person", people, []string{"name"}, nil, []string{"id"})
+	require.NoError(t, err)
+	require.Equal(t, []insertPerson{{ID: 7, Name: "Alpha"}, {ID: 8, Name: "Beta"}}, people)
+	require.Equal(t, []string{"Insert into person (name) Values ($1),($2) Returning id"}, fdb.log())
+
+	fdb.statements = nil
+	fdb.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+		return &fakeRows{cols: []string{"id", "name"}, rows: [][]driver.Value{{int64(9), "Gamma"}}}, nil
+	}
+
+	person := &insertPerson{Name: "gamma"}
+	err = db.InsertStructsReturning(context.Background(), "person", person, []string{"name"}, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, &insertPerson{ID: 9, Name: "Gamma"}, person)
+	require.Equal(t, []string{"Insert into person (name) Values ($1) Returning *"}, fdb.log())
+
+	err = db.InsertStructsReturning(context.Background(), "person", insertPerson{}, []string{"name"}, nil, nil)
+	require.EqualValues(t, &WrongTypeErr{"target struct must be passed by pointer"}, err)
+
+	// an insert returning fewer rows than inserted, eg. with On Conflict Do Nothing
+	fdb.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+		return &fakeRows{cols: []string{"id"}, rows: [][]driver.Value{{int64(7)}}}, nil
+	}
+
+	people = []insertPerson{{Name: "Alpha"}, {Name: "Beta"}}
+	err = db.InsertStructsReturning(context.Background(), "person", people, []string{"name"}, nil, []string{"id"})
+	require.EqualError(t, err, "insert returned 1 rows for the 2 inserted")
+}
+
+type fakeLastIDResult struct {
+	id int64
+}
+
+func (r fakeLastIDResult) LastInsertId() (int64, error) {
+	return r.id, nil
+}
+
+func (r fakeLastIDResult) RowsAffected() (int64, error) {
+	return 1, nil
+}
+
+func TestDBX_InsertStructsReturning_Mysql(t *testing.T) {
+	db, fdb := newFakeDBX(MysqlDriver)
+
+	fdb.exec = func(query string, args []driver.NamedValue) (driver.Result, error) {
+		return fakeLastIDResult{42}, nil
+	}
+
+	person := &insertPerson{Name: "Alpha"}
+	err := db.InsertStructsReturning(context.Background(), "person", person, []string{"name"}, nil, []string{"id"})
+	require.NoError(t, err)
+	require.EqualValues(t, 42, person.ID)
+	require.Equal(t, []string{"Insert into person (name) Values (?)"}, fdb.log())
+
+	people := []insertPerson{{Name: "Alpha"}, {Name: "Beta"}}
+	err = db.InsertStructsReturning(context.Background(), "person", people, []string{"name"}, nil, []string{"id"})
+	require.Error(t, err)
+}
+
+func Test_rowsPerBatch(t *testing.T) {
+	require.Equal(t, 65535/4, rowsPerBatch(PostgresDriver, 4, 0))
+	require.Equal(t, 65535/4, rowsPerBatch(PgxDriver, 4, 100000))
+	require.Equal(t, 100, rowsPerBatch(PgxDriver, 4, 100))
+	require.Equal(t, 32766/3, rowsPerBatch(Sqlite3Driver, 3, 0))
+	require.Equal(t, 65535, rowsPerBatch(MysqlDriver, 0, 0))
+}
+
+func TestDBX_BulkInsert(t *testing.T) {
+	db, fdb := newFakeDBX(PostgresDriver)
+
+	fdb.exec = func(query string, args []driver.NamedValue) (driver.Result, error) {
+		return driver.RowsAffected(len(args)), nil
+	}
+
+	people := make([]*insertPerson, 5)
+	for i := range people {
+		people[i] = &insertPerson{Name: "p"}
+	}
+
+	overrides := map[string]interface{}{}
+	res, err := db.BulkInsert(context.Background(), "person", people, []string{"name"}, overrides, BulkInsertOption{BatchSize: 2, SingleTx: true})
+	require.NoError(t, err)
+
+	affected, err := res.RowsAffected()
+	require.NoError(t, err)
+	require.EqualValues(t, 5, affected)
+	require.Empty(t, overrides)
+	require.Equal(t, []string{
+		"BEGIN",
+		"Insert into person (name) Values ($1),($2)",
+		"Insert into person (name) Values ($1),($2)",
+		"Insert into person (name) Values ($1)",
+		"COMMIT",
+	}, fdb.log())
+}
+
+func TestDBX_BulkInsert_SingleTxConflict(t *testing.T) {
+	db, fdb := newFakeDBX(PostgresDriver)
+	db.SetTxRetryPolicy(DefaultTxRetryPolicy)
+
+	fdb.exec = func(query string, args []driver.NamedValue) (driver.Result, error) {
+		return nil, &fakePgError{Code: "40001"}
+	}
+
+	people := []insertPerson{{Name: "Alpha"}, {Name: "Beta"}}
+	_, err := db.BulkInsert(context.Background(), "person", people, []string{"name"}, nil, BulkInsertOption{BatchSize: 1, SingleTx: true})
+	require.True(t, errors.Is(err, ErrSerialization))
+
+	// the import isn't replayed
+	require.Equal(t, []string{"BEGIN", "Insert into person (name) Values ($1)", "ROLLBACK"}, fdb.log())
+}
+
+func TestDBX_BulkInsert_MaxBatchBytes(t *testing.T) {
+	db, fdb := newFakeDBX(MysqlDriver)
+
+	people := []insertPerson{
+		{Name: strings.Repeat("a", 10)},
+		{Name: strings.Repeat("b", 10)},
+		{Name: strings.Repeat("c", 30)},
+		{Name: strings.Repeat("d", 5)},
+	}
+
+	res, err := db.BulkInsert(context.Background(), "person", people, []string{"id", "name"}, nil, BulkInsertOption{MaxBatchBytes: 40})
+	require.NoError(t, err)
+
+	affected, err := res.RowsAffected()
+	require.NoError(t, err)
+	require.EqualValues(t, 3, affected)
+	require.Equal(t, []string{
+		"Insert into person (id,name) Values (?,?),(?,?)",
+		"Insert into person (id,name) Values (?,?)",
+		"Insert into person (id,name) Values (?,?)",
+	}, fdb.log())
+}
+
+func Test_splitInsertTargetBySize(t *testing.T) {
+	people := []*insertPerson{{Name: "abcd"}, {Name: "ef"}, {Name: "ghijklmnop"}, {Name: "q"}, {Name: "r"}}
+
+	batches, err := splitInsertTargetBySize(people, []string{"name"}, nil, 2, 6)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{people[0:2], people[2:3], people[3:5]}, batches)
+
+	person := insertPerson{Name: "Alpha"}
+	batches, err = splitInsertTargetBySize(person, []string{"name"}, nil, 2, 1)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{person}, batches)
+}
@@ -0,0 +1,181 @@
+package dbx
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var regSortColumn = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// keysetAlias names the subquery a keyset page is selected from
+const keysetAlias = "dbx_page"
+
+// SortKey is a column a keyset page is ordered by
+type SortKey struct {
+	Column string
+	Desc   bool
+}
+
+// NewKeysetOption returns an option selecting the limit rows following cursor, ordered by keys.
+// cursor is the token returned by QueryOption.Cursor for the last row of the previous page, or empty
+// for the first page.
+func NewKeysetOption(keys []SortKey, cursor string, limit int) (QueryOption, error) {
+	if len(keys) == 0 {
+		return QueryOption{}, &MissingParamErr{"no sort key for keyset pagination"}
+	}
+
+	for _, k := range keys {
+		if !regSortColumn.MatchString(k.Column) {
+			return QueryOption{}, &WrongTypeErr{fmt.Sprintf("invalid sort column '%s'", k.Column)}
+		}
+	}
+
+	qo := QueryOption{qType: qTypeKeyset, page: 1, limits: DefaultPageLimits, limit: DefaultPageLimits.clamp(limit), keys: keys}
+	if cursor == "" {
+		return qo, nil
+	}
+
+	after, err := DecodeCursor(cursor)
+	if err != nil {
+		return QueryOption{}, err
+	}
+
+	if len(after) != len(keys) {
+		return QueryOption{}, &WrongTypeErr{fmt.Sprintf("cursor holds %d values for %d sort keys", len(after), len(keys))}
+	}
+
+	qo.after = after
+	return qo, nil
+}
+
+// Cursor returns the token selecting the rows after the one holding values, given in the order of the sort keys
+func (qo QueryOption) Cursor(values ...interface{}) (string, error) {
+	if len(values) != len(qo.keys) {
+		return "", &WrongTypeErr{fmt.Sprintf("%d cursor values given for %d sort keys", len(values), len(qo.keys))}
+	}
+
+	return EncodeCursor(values)
+}
+
+// EncodeCursor encodes the sort key values of a row into an opaque url-safe token
+func EncodeCursor(values []interface{}) (string, error) {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecodeCursor returns the values encoded by EncodeCursor. Integers are decoded as int64,
+// other numbers as float64.
+func DecodeCursor(cursor string) ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, &WrongTypeErr{"invalid cursor"}
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+	dec.UseNumber()
+
+	var values []interface{}
+	if err := dec.Decode(&values); err != nil {
+		return nil, &WrongTypeErr{"invalid cursor"}
+	}
+
+	for i, v := range values {
+		n, ok := v.(json.Number)
+		if !ok {
+			continue
+		}
+
+		if values[i], err = n.Int64(); err != nil {
+			if values[i], err = n.Float64(); err != nil {
+				return nil, &WrongTypeErr{"invalid cursor"}
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// withKeyset selects the page of query following the cursor.
+// eg. Select * From (query) As dbx_page Where (a, b) > (?, ?) Order By a, b Limit ?
+func withKeyset(qo QueryOption, query string, args []interface{}) (string, []interface{}) {
+	query = fmt.Sprintf("Select * From (%s) As %s", query, keysetAlias)
+
+	if len(qo.after) > 0 {
+		cond, condArgs := keysetCondition(qo.keys, qo.after)
+		query += " Where " + cond
+		args = append(args, condArgs...)
+	}
+
+	query += " Order By " + orderByKeys(qo.keys) + " Limit ?"
+	args = append(args, qo.Limit())
+
+	return query, args
+}
+
+// keysetCondition matches the rows sorted after values. Keys sharing a direction are compared as a row,
+// mixed directions are expanded. eg. a > ? Or (a = ? And b < ?)
+func keysetCondition(keys []SortKey, values []interface{}) (string, []interface{}) {
+	mixed := false
+	for _, k := range keys[1:] {
+		mixed = mixed || k.Desc != keys[0].Desc
+	}
+
+	if !mixed {
+		cols := make([]string, len(keys))
+		for i, k := range keys {
+			cols[i] = k.Column
+		}
+
+		op := keysetOperator(keys[0])
+		if len(keys) == 1 {
+			return cols[0] + " " + op + " ?", values
+		}
+
+		marks := strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ")
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(cols, ", "), op, marks), values
+	}
+
+	var conds []string
+	var args []interface{}
+	for i, k := range keys {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, keys[j].Column+" = ?")
+			args = append(args, values[j])
+		}
+
+		parts = append(parts, k.Column+" "+keysetOperator(k)+" ?")
+		args = append(args, values[i])
+
+		conds = append(conds, "("+strings.Join(parts, " And ")+")")
+	}
+
+	return "(" + strings.Join(conds, " Or ") + ")", args
+}
+
+func keysetOperator(k SortKey) string {
+	if k.Desc {
+		return "<"
+	}
+
+	return ">"
+}
+
+func orderByKeys(keys []SortKey) string {
+	order := make([]string, len(keys))
+	for i, k := range keys {
+		order[i] = k.Column
+		if k.Desc {
+			order[i] += " Desc"
+		}
+	}
+
+	return strings.Join(order, ", ")
+}
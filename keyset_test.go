@@ -0,0 +1,134 @@
+package dbx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WithOptions_Keyset(t *testing.T) {
+	asc := []SortKey{{Column: "created_at"}, {Column: "id"}}
+	desc := []SortKey{{Column: "created_at", Desc: true}, {Column: "id", Desc: true}}
+	mixed := []SortKey{{Column: "score", Desc: true}, {Column: "name"}, {Column: "id"}}
+
+	cursor := func(values ...interface{}) string {
+		c, err := EncodeCursor(values)
+		require.NoError(t, err)
+		return c
+	}
+
+	cases := []struct {
+		name          string
+		keys          []SortKey
+		cursor        string
+		limit         int
+		expectedQuery string
+		expectedArgs  []interface{}
+	}{
+		{
+			name:          "First page",
+			keys:          asc,
+			limit:         10,
+			expectedQuery: "Select * From (Select * From t Where a = ?) As dbx_page Order By created_at, id Limit ?",
+			expectedArgs:  []interface{}{1, 10},
+		},
+		{
+			name:          "Ascending keys",
+			keys:          asc,
+			cursor:        cursor("2020-01-01", 42),
+			limit:         10,
+			expectedQuery: "Select * From (Select * From t Where a = ?) As dbx_page Where (created_at, id) > (?, ?) Order By created_at, id Limit ?",
+			expectedArgs:  []interface{}{1, "2020-01-01", int64(42), 10},
+		},
+		{
+			name:          "Descending keys",
+			keys:          desc,
+			cursor:        cursor("2020-01-01", 42),
+			expectedQuery: "Select * From (Select * From t Where a = ?) As dbx_page Where (created_at, id) < (?, ?) Order By created_at Desc, id Desc Limit ?",
+			expectedArgs:  []interface{}{1, "2020-01-01", int64(42), 25},
+		},
+		{
+			name:          "Single key",
+			keys:          []SortKey{{Column: "id"}},
+			cursor:        cursor(42),
+			limit:         5,
+			expectedQuery: "Select * From (Select * From t Where a = ?) As dbx_page Where id > ? Order By id Limit ?",
+			expectedArgs:  []interface{}{1, int64(42), 5},
+		},
+		{
+			name:          "Mixed directions",
+			keys:          mixed,
+			cursor:        cursor(9.5, "bob", 42),
+			limit:         5,
+			expectedQuery: "Select * From (Select * From t Where a = ?) As dbx_page Where ((score < ?) Or (score = ? And name > ?) Or (score = ? And name = ? And id > ?)) Order By score Desc, name, id Limit ?",
+			expectedArgs:  []interface{}{1, 9.5, 9.5, "bob", 9.5, "bob", int64(42), 5},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opt, err := NewKeysetOption(c.keys, c.cursor, c.limit)
+			require.NoError(t, err)
+
+			query, args := WithOptions([]QueryOption{opt}, "Select * From t Where a = ?;", 1)
+			require.Equal(t, c.expectedQuery, query)
+			require.Equal(t, c.expectedArgs, args)
+		})
+	}
+}
+
+func Test_NewKeysetOption_Errors(t *testing.T) {
+	valid, err := EncodeCursor([]interface{}{1})
+	require.NoError(t, err)
+
+	cases := []struct {
+		name        string
+		keys        []SortKey
+		cursor      string
+		expectedErr error
+	}{
+		{
+			name:        "No key",
+			expectedErr: &MissingParamErr{"no sort key for keyset pagination"},
+		},
+		{
+			name:        "Invalid column",
+			keys:        []SortKey{{Column: "id; Drop Table t"}},
+			expectedErr: &WrongTypeErr{"invalid sort column 'id; Drop Table t'"},
+		},
+		{
+			name:        "Invalid cursor",
+			keys:        []SortKey{{Column: "id"}},
+			cursor:      "not a cursor",
+			expectedErr: &WrongTypeErr{"invalid cursor"},
+		},
+		{
+			name:        "Cursor not matching the keys",
+			keys:        []SortKey{{Column: "a"}, {Column: "b"}},
+			cursor:      valid,
+			expectedErr: &WrongTypeErr{"cursor holds 1 values for 2 sort keys"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := NewKeysetOption(c.keys, c.cursor, 10)
+			require.Equal(t, c.expectedErr, err)
+		})
+	}
+}
+
+func Test_QueryOption_Cursor(t *testing.T) {
+	opt, err := NewKeysetOption([]SortKey{{Column: "name"}, {Column: "id"}}, "", 10)
+	require.NoError(t, err)
+
+	cursor, err := opt.Cursor("alpha", 7)
+	require.NoError(t, err)
+
+	next, err := NewKeysetOption(opt.keys, cursor, 10)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"alpha", int64(7)}, next.after)
+
+	_, err = opt.Cursor("alpha")
+	require.Error(t, err)
+}
@@ -1,9 +1,11 @@
 package dbx
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"log"
+	"log/slog"
 	"regexp"
 	"time"
 
@@ -20,35 +22,65 @@ const (
 	DefaultSlowLogMin = 1 * time.Second
 )
 
+// LogEntry is the structured record passed to a QueryLogger for every logged statement or event
+type LogEntry struct {
+	Level    string
+	Time     time.Time
+	Query    string
+	Args     []interface{}
+	Duration time.Duration
+	Err      error
+	Stack    string
+	InTx     bool
+
+	// Msg describes events that aren't tied to a single statement, eg. a transaction retry
+	Msg string
+}
+
+// QueryLogger receives the statements and events logged by DBX and Tx
+type QueryLogger interface {
+	LogQuery(entry *LogEntry) error
+}
+
 type qLog struct {
 	Level    string
 	Time     time.Time
-	Query    string        `json:"query"`
+	Query    string        `json:"query,omitempty"`
+	Msg      string        `json:"msg,omitempty"`
 	ExecTime time.Duration `json:"exec_time_ns"`
 	Error    string        `json:"error_msg,omitempty"`
 	Trace    string        `json:"trace,omitempty"`
 	Args     []interface{} `json:"args,omitempty"`
+	InTx     bool          `json:"in_tx,omitempty"`
 }
 
 var regSpaceTrim *regexp.Regexp
 
-func (dbx *DBX) SetLogger(logType int8, out io.Writer) error {
-	if logType != LogError && logType != LogDebug && logType != LogSLow {
-		return errors.New("given log type doesn't exist")
-	}
+// loggers holds the logging configuration shared by DBX and the transactions it starts
+type loggers struct {
+	errorLog   QueryLogger
+	debugLog   QueryLogger
+	slowLog    QueryLogger
+	slowLogMin time.Duration
+	logAsync   bool
+}
 
-	newLogger := log.New(out, "", log.LUTC)
+// SetLogger writes the given log type to out, one JSON object per line
+func (dbx *DBX) SetLogger(logType int8, out io.Writer) error {
+	return dbx.SetQueryLogger(logType, NewJSONLogger(out))
+}
 
+// SetQueryLogger sends the given log type to logger. A nil logger disables that log type.
+func (dbx *DBX) SetQueryLogger(logType int8, logger QueryLogger) error {
 	switch logType {
 	case LogError:
-		newLogger.SetPrefix("")
-		dbx.errorLog = newLogger
+		dbx.errorLog = logger
 	case LogDebug:
-		newLogger.SetPrefix("")
-		dbx.debugLog = newLogger
+		dbx.debugLog = logger
 	case LogSLow:
-		newLogger.SetPrefix("")
-		dbx.slowLog = newLogger
+		dbx.slowLog = logger
+	default:
+		return errors.New("given log type doesn't exist")
 	}
 
 	return nil
@@ -62,38 +94,168 @@ func (dbx *DBX) SetLoggerAsync(async bool) {
 	dbx.logAsync = async
 }
 
-func logMsg(logger *log.Logger, level string, query string, execTime time.Duration, err error, args ...interface{}) error {
-	msg, parseErr := parseQuery(level, query, execTime, err, args...)
-	if parseErr != nil {
-		return parseErr
+func (l loggers) logQuery(query string, execTime time.Duration, err error, inTx bool, args ...interface{}) error {
+	if l.logAsync == true {
+		go l.log(query, execTime, err, inTx, args...)
+		return nil
+	}
+
+	return l.log(query, execTime, err, inTx, args...)
+}
+
+// notRun is the execTime logged for the statements a hook prevented from running, which are never slow
+const notRun time.Duration = -1
+
+func (l loggers) log(query string, execTime time.Duration, err error, inTx bool, args ...interface{}) error {
+	now := time.Now()
+
+	slow := execTime != notRun && execTime >= l.slowLogMin
+	if execTime == notRun {
+		execTime = 0
+	}
+
+	if err != nil && l.errorLog != nil {
+		entry := &LogEntry{Level: errorLevel(err), Time: now, Query: query, Args: args, Duration: execTime, Err: err, InTx: inTx}
+		entry.Stack = errorTrace(errors.WithStack(err))
+
+		if err2 := l.errorLog.LogQuery(entry); err2 != nil {
+			return err2
+		}
+	}
+
+	if slow && l.slowLog != nil {
+		entry := &LogEntry{Level: LevelSlowQuery, Time: now, Query: query, Args: args, Duration: execTime, InTx: inTx}
+		if err3 := l.slowLog.LogQuery(entry); err3 != nil {
+			return err3
+		}
+	}
+
+	if l.debugLog != nil {
+		entry := &LogEntry{Level: LevelDebug, Time: now, Query: query, Args: args, Duration: execTime, InTx: inTx}
+		if err4 := l.debugLog.LogQuery(entry); err4 != nil {
+			return err4
+		}
 	}
 
-	logger.Println(string(msg))
 	return nil
 }
 
-type stackTracer interface {
-	StackTrace() errors.StackTrace
+// logEvent writes a message that isn't tied to a single statement to the error log
+func (l loggers) logEvent(level string, msg string, err error) {
+	if l.errorLog == nil {
+		return
+	}
+
+	entry := &LogEntry{Level: level, Time: time.Now(), Msg: msg, Err: err}
+	if err != nil {
+		entry.Stack = errorTrace(errors.WithStack(err))
+	}
+
+	l.errorLog.LogQuery(entry)
 }
 
-func parseQuery(level string, query string, dur time.Duration, err error, args ...interface{}) ([]byte, error) {
-	query = removeComments(query)
-	query = regSpaceTrim.ReplaceAllString(query, " ")
+// errorLevel tells a cancelled or timed out statement apart from a failed one. The drivers report a
+// cancelled statement with their own error, eg. SQLSTATE 57014 for postgres, so err is classified first.
+func errorLevel(err error) string {
+	if errors.Is(ClassifyError(err), ErrQueryCanceled) {
+		return LevelCanceled
+	}
 
-	errMsg := ""
-	trace := ""
+	return LevelError
+}
+
+type jsonLogger struct {
+	out *log.Logger
+}
+
+// NewJSONLogger returns a QueryLogger writing each entry to out as a single JSON line
+func NewJSONLogger(out io.Writer) QueryLogger {
+	return &jsonLogger{out: log.New(out, "", log.LUTC)}
+}
+
+func (l *jsonLogger) LogQuery(entry *LogEntry) error {
+	msg, err := parseQuery(entry)
 	if err != nil {
-		serr := errors.Wrap(err, "")
-		errMsg = serr.Error()
+		return err
+	}
 
-		if sterr, ok := serr.(stackTracer); ok {
-			for i, f := range sterr.StackTrace() {
-				trace += fmt.Sprintf("%+s:%d", f, i)
-			}
-		}
+	l.out.Println(string(msg))
+	return nil
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns a QueryLogger forwarding entries to a log/slog Logger.
+// Errors are logged at slog.LevelError, slow queries, cancellations and retries at slog.LevelWarn
+// and debug entries at slog.LevelDebug.
+func NewSlogLogger(logger *slog.Logger) QueryLogger {
+	return &slogLogger{logger}
+}
+
+func (l *slogLogger) LogQuery(entry *LogEntry) error {
+	attrs := []slog.Attr{slog.String("dbx_level", entry.Level)}
+
+	if entry.Query != "" {
+		attrs = append(attrs,
+			slog.String("query", cleanQuery(entry.Query)),
+			slog.Any("args", entry.Args),
+			slog.Duration("duration", entry.Duration),
+		)
+	}
+
+	if entry.Err != nil {
+		attrs = append(attrs, slog.String("error", entry.Err.Error()))
+	}
+
+	if entry.Stack != "" {
+		attrs = append(attrs, slog.String("stack", entry.Stack))
+	}
+
+	attrs = append(attrs, slog.Bool("in_tx", entry.InTx))
+
+	msg := entry.Msg
+	if msg == "" {
+		msg = "dbx query"
+	}
+
+	l.logger.LogAttrs(context.Background(), slogLevel(entry.Level), msg, attrs...)
+	return nil
+}
+
+func slogLevel(level string) slog.Level {
+	switch level {
+	case LevelError:
+		return slog.LevelError
+	case LevelDebug:
+		return slog.LevelDebug
+	}
+
+	return slog.LevelWarn
+}
+
+type stackTracer interface {
+	StackTrace() errors.StackTrace
+}
+
+func parseQuery(entry *LogEntry) ([]byte, error) {
+	errMsg := ""
+	if entry.Err != nil {
+		errMsg = entry.Err.Error()
 	}
 
-	l := qLog{level, time.Now(), query, dur, errMsg, trace, args}
+	l := qLog{
+		Level:    entry.Level,
+		Time:     entry.Time,
+		Query:    cleanQuery(entry.Query),
+		Msg:      entry.Msg,
+		ExecTime: entry.Duration,
+		Error:    errMsg,
+		Trace:    entry.Stack,
+		Args:     entry.Args,
+		InTx:     entry.InTx,
+	}
 
 	lB, err := json.Marshal(l)
 	if err != nil {
@@ -102,3 +264,21 @@ func parseQuery(level string, query string, dur time.Duration, err error, args .
 
 	return lB, nil
 }
+
+// cleanQuery strips comments and collapses whitespace so a query fits on a single line
+func cleanQuery(query string) string {
+	query = removeComments(query)
+	return regSpaceTrim.ReplaceAllString(query, " ")
+}
+
+func errorTrace(err error) string {
+	trace := ""
+
+	if sterr, ok := err.(stackTracer); ok {
+		for i, f := range sterr.StackTrace() {
+			trace += fmt.Sprintf("%+s:%d", f, i)
+		}
+	}
+
+	return trace
+}
@@ -0,0 +1,74 @@
+package dbx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONLogger(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger := NewJSONLogger(out)
+
+	err := logger.LogQuery(&LogEntry{
+		Level:    LevelError,
+		Query:    "select *\nfrom person -- all of them\nwhere id = ?",
+		Args:     []interface{}{1},
+		Duration: 2 * time.Millisecond,
+		Err:      errors.New("boom"),
+		InTx:     true,
+	})
+	require.NoError(t, err)
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &line))
+	require.Equal(t, LevelError, line["Level"])
+	require.Equal(t, "select * from person where id = ?", line["query"])
+	require.Equal(t, "boom", line["error_msg"])
+	require.EqualValues(t, 2*time.Millisecond, line["exec_time_ns"])
+	require.Equal(t, true, line["in_tx"])
+}
+
+func TestSlogLogger(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger := NewSlogLogger(slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	require.NoError(t, logger.LogQuery(&LogEntry{Level: LevelSlowQuery, Query: "select 1", Duration: time.Second}))
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &line))
+	require.Equal(t, "WARN", line["level"])
+	require.Equal(t, LevelSlowQuery, line["dbx_level"])
+	require.Equal(t, "select 1", line["query"])
+	require.Equal(t, false, line["in_tx"])
+}
+
+func Test_errorLevel(t *testing.T) {
+	require.Equal(t, LevelError, errorLevel(errors.New("boom")))
+	require.Equal(t, LevelCanceled, errorLevel(context.Canceled))
+	require.Equal(t, LevelCanceled, errorLevel(errors.Wrap(context.DeadlineExceeded, "select")))
+	require.Equal(t, LevelCanceled, errorLevel(&fakePqError{Code: pgQueryCanceled}))
+	require.Equal(t, LevelCanceled, errorLevel(&fakeMysqlError{Number: mysqlQueryInterrupted, Message: "Error 1317: Query execution was interrupted"}))
+}
+
+func TestLogger_DriverCanceled(t *testing.T) {
+	db, fdb := newFakeDBX(PostgresDriver)
+	logs := &bytes.Buffer{}
+	db.SetLogger(LogError, logs)
+
+	// lib/pq reports a statement cancelled by its context with SQLSTATE 57014
+	fdb.wait = func(ctx context.Context) error {
+		return &fakePqError{Code: pgQueryCanceled}
+	}
+
+	_, err := db.ExecContext(context.Background(), "update a set b = 1")
+	require.True(t, errors.Is(err, ErrQueryCanceled), err)
+	require.Contains(t, logs.String(), LevelCanceled)
+	require.NotContains(t, logs.String(), `"`+LevelError+`"`)
+}
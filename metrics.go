@@ -0,0 +1,253 @@
+package dbx
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the query latency histogram
+var DefaultLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DefaultMaxFingerprints caps the number of distinct query fingerprints tracked by Metrics.
+// Statements beyond that limit are counted under the fingerprint "other".
+const DefaultMaxFingerprints = 500
+
+const otherFingerprint = "other"
+
+var (
+	regFpString  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	regFpNumber  = regexp.MustCompile(`\b\d+(\.\d+)?\b`)
+	regFpBind    = regexp.MustCompile(`(\$\d+|@p\d+)`)
+	regFpList    = regexp.MustCompile(`\(\s*\?(\s*,\s*\?)*\s*\)`)
+	regFpTuples  = regexp.MustCompile(`\(\?\+\)(\s*,\s*\(\?\+\))+`)
+	regFpComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+)
+
+// Metrics collects query latency, query and error counts by statement type and query fingerprint,
+// and exposes them along with the connection pool statistics in the Prometheus text format.
+type Metrics struct {
+	mu              sync.Mutex
+	buckets         []float64
+	maxFingerprints int
+	series          map[seriesKey]*querySeries
+	stats           func() sql.DBStats
+}
+
+type seriesKey struct {
+	statement   string
+	fingerprint string
+}
+
+type querySeries struct {
+	count   uint64
+	errors  uint64
+	retries uint64
+	sum     float64
+	buckets []uint64
+}
+
+// NewMetrics creates an empty collector. stats may be nil, in which case no pool gauges are exposed.
+func NewMetrics(stats func() sql.DBStats) *Metrics {
+	return &Metrics{
+		buckets:         DefaultLatencyBuckets,
+		maxFingerprints: DefaultMaxFingerprints,
+		series:          map[seriesKey]*querySeries{},
+		stats:           stats,
+	}
+}
+
+// EnableMetrics starts collecting metrics for every statement run through dbx and the
+// transactions started afterwards. The returned *Metrics is an http.Handler.
+func (dbx *DBX) EnableMetrics() *Metrics {
+	if dbx.metrics == nil {
+		dbx.metrics = NewMetrics(dbx.db.Stats)
+	}
+
+	return dbx.metrics
+}
+
+// observe records a statement that ran for dur
+func (m *Metrics) observe(query string, dur time.Duration, err error) {
+	secs := dur.Seconds()
+	key := newSeriesKey(query)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.seriesOf(key)
+	s.count++
+	s.sum += secs
+	if err != nil {
+		s.errors++
+	}
+
+	for i, upper := range m.buckets {
+		if secs <= upper {
+			s.buckets[i]++
+		}
+	}
+}
+
+// observeRetry records a statement run again after a failure
+func (m *Metrics) observeRetry(query string) {
+	key := newSeriesKey(query)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.seriesOf(key).retries++
+}
+
+// newSeriesKey normalizes query into the key of its series. It's computed before taking m.mu,
+// so the statements of concurrent goroutines don't wait on each other's fingerprint.
+func newSeriesKey(query string) seriesKey {
+	return seriesKey{statementType(query), fingerprint(query)}
+}
+
+// seriesOf returns the series of key, creating it if needed. m.mu must be held.
+func (m *Metrics) seriesOf(key seriesKey) *querySeries {
+	s, ok := m.series[key]
+	if !ok {
+		if len(m.series) >= m.maxFingerprints {
+			key.fingerprint = otherFingerprint
+			s, ok = m.series[key]
+		}
+
+		if !ok {
+			s = &querySeries{buckets: make([]uint64, len(m.buckets))}
+			m.series[key] = s
+		}
+	}
+
+	return s
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	bw := bufio.NewWriter(w)
+	m.writeText(bw)
+	bw.Flush()
+}
+
+// writeText writes every metric in the Prometheus text exposition format
+func (m *Metrics) writeText(w io.Writer) {
+	m.mu.Lock()
+	keys := make([]seriesKey, 0, len(m.series))
+	series := make(map[seriesKey]querySeries, len(m.series))
+	for k, s := range m.series {
+		keys = append(keys, k)
+		series[k] = querySeries{s.count, s.errors, s.retries, s.sum, append([]uint64(nil), s.buckets...)}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].statement != keys[j].statement {
+			return keys[i].statement < keys[j].statement
+		}
+		return keys[i].fingerprint < keys[j].fingerprint
+	})
+
+	writeHeader(w, "dbx_queries_total", "counter", "Number of statements run.")
+	for _, k := range keys {
+		fmt.Fprintf(w, "dbx_queries_total{%s} %d\n", k.labels(), series[k].count)
+	}
+
+	writeHeader(w, "dbx_query_errors_total", "counter", "Number of statements that returned an error.")
+	for _, k := range keys {
+		fmt.Fprintf(w, "dbx_query_errors_total{%s} %d\n", k.labels(), series[k].errors)
+	}
+
+	writeHeader(w, "dbx_query_retries_total", "counter", "Number of statements run again after a failure.")
+	for _, k := range keys {
+		fmt.Fprintf(w, "dbx_query_retries_total{%s} %d\n", k.labels(), series[k].retries)
+	}
+
+	writeHeader(w, "dbx_query_duration_seconds", "histogram", "Statement latency in seconds.")
+	for _, k := range keys {
+		s := series[k]
+		for i, upper := range m.buckets {
+			fmt.Fprintf(w, "dbx_query_duration_seconds_bucket{%s,le=\"%g\"} %d\n", k.labels(), upper, s.buckets[i])
+		}
+		fmt.Fprintf(w, "dbx_query_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", k.labels(), s.count)
+		fmt.Fprintf(w, "dbx_query_duration_seconds_sum{%s} %g\n", k.labels(), s.sum)
+		fmt.Fprintf(w, "dbx_query_duration_seconds_count{%s} %d\n", k.labels(), s.count)
+	}
+
+	if m.stats == nil {
+		return
+	}
+
+	st := m.stats()
+	writeMetric(w, "dbx_max_open_connections", "gauge", "Maximum number of open connections to the database.", float64(st.MaxOpenConnections))
+	writeMetric(w, "dbx_open_connections", "gauge", "Number of established connections, in use and idle.", float64(st.OpenConnections))
+	writeMetric(w, "dbx_in_use_connections", "gauge", "Number of connections currently in use.", float64(st.InUse))
+	writeMetric(w, "dbx_idle_connections", "gauge", "Number of idle connections.", float64(st.Idle))
+	writeMetric(w, "dbx_wait_count_total", "counter", "Number of connections waited for.", float64(st.WaitCount))
+	writeMetric(w, "dbx_wait_duration_seconds_total", "counter", "Time spent waiting for a connection.", st.WaitDuration.Seconds())
+	writeMetric(w, "dbx_max_idle_closed_total", "counter", "Connections closed due to the idle connection limit.", float64(st.MaxIdleClosed))
+	writeMetric(w, "dbx_max_idle_time_closed_total", "counter", "Connections closed due to the maximum idle time.", float64(st.MaxIdleTimeClosed))
+	writeMetric(w, "dbx_max_lifetime_closed_total", "counter", "Connections closed due to the maximum connection lifetime.", float64(st.MaxLifetimeClosed))
+}
+
+func (k seriesKey) labels() string {
+	return fmt.Sprintf("statement=\"%s\",fingerprint=\"%s\"", escapeLabel(k.statement), escapeLabel(k.fingerprint))
+}
+
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeMetric(w io.Writer, name, kind, help string, value float64) {
+	writeHeader(w, name, kind, help)
+	fmt.Fprintf(w, "%s %g\n", name, value)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+// statementType returns the upper-cased leading keyword of a query: SELECT, INSERT, UPDATE, DELETE or OTHER
+func statementType(query string) string {
+	switch kw := leadingKeyword(query); kw {
+	case "SELECT", "INSERT", "UPDATE", "DELETE":
+		return kw
+	}
+
+	return "OTHER"
+}
+
+// leadingKeyword returns the upper-cased first word of a query, skipping comments and opening parentheses
+func leadingKeyword(query string) string {
+	query = strings.TrimLeft(regFpComment.ReplaceAllString(cleanQuery(query), ""), " (")
+
+	end := strings.IndexAny(query, " (")
+	if end < 0 {
+		end = len(query)
+	}
+
+	return strings.ToUpper(query[:end])
+}
+
+// fingerprint normalizes a query so that statements only differing by their values share a series:
+// literals and placeholders become ?, and lists of values collapse to (?+)
+func fingerprint(query string) string {
+	query = regFpComment.ReplaceAllString(cleanQuery(query), "")
+	query = regFpString.ReplaceAllString(query, "?")
+	query = regFpBind.ReplaceAllString(query, "?")
+	query = regFpNumber.ReplaceAllString(query, "?")
+	query = regFpList.ReplaceAllString(query, "(?+)")
+	query = regFpTuples.ReplaceAllString(query, "(?+)")
+
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
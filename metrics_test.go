@@ -0,0 +1,93 @@
+package dbx
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_statementType(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{query: "select * from a", expected: "SELECT"},
+		{query: "  -- comment\n\tINSERT into a values (1)", expected: "INSERT"},
+		{query: "/* req-1 */ update a set b = 1", expected: "UPDATE"},
+		{query: "(select 1) union (select 2)", expected: "SELECT"},
+		{query: "Delete From a", expected: "DELETE"},
+		{query: "with x as (select 1) select * from x", expected: "OTHER"},
+		{query: "", expected: "OTHER"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, statementType(test.query), test.query)
+	}
+}
+
+func Test_fingerprint(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{query: "SELECT * FROM a WHERE id = 42 AND name = 'it''s'", expected: "select * from a where id = ? and name = ?"},
+		{query: "select * from a where id = $1 and b in ($2, $3, $4)", expected: "select * from a where id = ? and b in (?+)"},
+		{query: "select * from a where b in (?)", expected: "select * from a where b in (?+)"},
+		{query: "insert into a (x,y) values (?,?),(?,?),(?,?)", expected: "insert into a (x,y) values (?+)"},
+		{query: "select * from table1 /* hint */\n  where x = 1.5", expected: "select * from table1 where x = ?"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, fingerprint(test.query), test.query)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics(nil)
+	m.observe("select * from a where id = $1", 3*time.Millisecond, nil)
+	m.observe("select * from a where id = $1", 200*time.Millisecond, errors.New("boom"))
+	m.observe("delete from a", time.Millisecond, nil)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+
+	require.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain"))
+	require.Contains(t, out, "# TYPE dbx_query_duration_seconds histogram\n")
+	require.Contains(t, out, `dbx_queries_total{statement="SELECT",fingerprint="select * from a where id = ?"} 2`)
+	require.Contains(t, out, `dbx_query_errors_total{statement="SELECT",fingerprint="select * from a where id = ?"} 1`)
+	require.Contains(t, out, `dbx_query_errors_total{statement="DELETE",fingerprint="delete from a"} 0`)
+	require.Contains(t, out, `dbx_query_duration_seconds_bucket{statement="SELECT",fingerprint="select * from a where id = ?",le="0.005"} 1`)
+	require.Contains(t, out, `dbx_query_duration_seconds_bucket{statement="SELECT",fingerprint="select * from a where id = ?",le="0.25"} 2`)
+	require.Contains(t, out, `dbx_query_duration_seconds_bucket{statement="SELECT",fingerprint="select * from a where id = ?",le="+Inf"} 2`)
+	require.Contains(t, out, `dbx_query_duration_seconds_count{statement="DELETE",fingerprint="delete from a"} 1`)
+}
+
+func TestMetrics_MaxFingerprints(t *testing.T) {
+	m := NewMetrics(nil)
+	m.maxFingerprints = 1
+
+	m.observe("select * from a", time.Millisecond, nil)
+	m.observe("select * from b", time.Millisecond, nil)
+	m.observe("select * from c", time.Millisecond, nil)
+
+	require.Len(t, m.series, 2)
+	require.EqualValues(t, 2, m.series[seriesKey{"SELECT", otherFingerprint}].count)
+}
+
+func TestDBX_EnableMetrics(t *testing.T) {
+	db, _ := newFakeDBX(PostgresDriver)
+	m := db.EnableMetrics()
+
+	_, err := db.Exec("update a set b = ?", 1)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Contains(t, rec.Body.String(), `dbx_queries_total{statement="UPDATE",fingerprint="update a set b = ?"} 1`)
+	require.Contains(t, rec.Body.String(), "dbx_open_connections ")
+}
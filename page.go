@@ -0,0 +1,272 @@
+package dbx
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// pageTotalColumn holds the total number of rows in the paged queries counting with a window function
+const pageTotalColumn = "dbx_total"
+
+// PageResult describes the page selected by SelectPage
+type PageResult struct {
+	// Total is the number of rows the query returns without pagination
+	Total    int64
+	Page     int
+	PageSize int
+	HasNext  bool
+}
+
+// SelectPage selects the page of query described by opt into dest, a pointer to a slice, and counts the rows
+// of the whole query in the same round trip. Postgres and sqlite 3.25+ count with a count(*) Over() window
+// added to the select list, mysql, older sqlite versions, compound and Select Distinct queries with a separate
+// count query. Rows are appended to dest.
+// Keyset options and locking queries aren't supported.
+func (dbx *DBX) SelectPage(ctx context.Context, dest interface{}, query string, opt QueryOption, args ...interface{}) (PageResult, error) {
+	return selectPage(ctx, dbx, dest, query, opt, args)
+}
+
+func (tx *Tx) SelectPage(ctx context.Context, dest interface{}, query string, opt QueryOption, args ...interface{}) (PageResult, error) {
+	return selectPage(ctx, tx, dest, query, opt, args)
+}
+
+func selectPage(ctx context.Context, querier dbxInternal, dest interface{}, query string, opt QueryOption, args []interface{}) (PageResult, error) {
+	if opt.qType == qTypeKeyset {
+		return PageResult{}, &WrongTypeErr{"SelectPage doesn't support keyset pagination"}
+	}
+
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.IsNil() || slice.Elem().Kind() != reflect.Slice {
+		return PageResult{}, &WrongTypeErr{"dest must be a pointer to a slice"}
+	}
+	slice = slice.Elem()
+	before := slice.Len()
+
+	query, lock := splitLockingClause(trimSemiColumn(query))
+	if lock != "" {
+		return PageResult{}, &WrongTypeErr{"can't count the rows of a locking query"}
+	}
+
+	window, err := supportsWindow(ctx, querier)
+	if err != nil {
+		return PageResult{}, err
+	}
+
+	var total int64
+	windowQuery, ok := withTotalColumn(query)
+
+	if window && ok {
+		total, err = selectWithTotal(ctx, querier, slice, windowQuery, opt, args)
+		if err != nil {
+			return PageResult{}, err
+		}
+
+		// the window can't count the rows of a page past the end
+		if slice.Len() == before && opt.offset > 0 {
+			total, err = countRows(ctx, querier, query, args)
+			if err != nil {
+				return PageResult{}, err
+			}
+		}
+	} else {
+		q, pageArgs, err := paginate(querier.driverName(), opt, query, args)
+		if err != nil {
+			return PageResult{}, err
+		}
+
+		total, err = countRows(ctx, querier, query, args)
+		if err != nil {
+			return PageResult{}, err
+		}
+
+		page := reflect.New(slice.Type())
+		if err := selectX(ctx, querier, page.Interface(), q, pageArgs...); err != nil {
+			return PageResult{}, err
+		}
+
+		slice.Set(reflect.AppendSlice(slice, page.Elem()))
+	}
+
+	return PageResult{
+		Total:    total,
+		Page:     opt.Page(),
+		PageSize: opt.Limit(),
+		HasNext:  int64(opt.offset+slice.Len()-before) < total,
+	}, nil
+}
+
+// supportsWindow tells whether the database of querier can count the rows of a page with a window function
+func supportsWindow(ctx context.Context, querier dbxInternal) (bool, error) {
+	switch driver := querier.driverName(); driver {
+	case MysqlDriver:
+		return false, nil
+	case PgxDriver, PostgresDriver:
+		return true, nil
+	case Sqlite3Driver:
+		return querier.getServer().sqliteWindow(ctx, querier)
+	default:
+		return false, fmt.Errorf("driver %s not supported", driver)
+	}
+}
+
+// serverInfo caches what dbx detects about the database it's connected to
+type serverInfo struct {
+	mu     sync.Mutex
+	window *bool
+}
+
+// sqliteWindow tells whether the sqlite library supports window functions. Its version is checked on first
+// use, again after a failed check.
+func (s *serverInfo) sqliteWindow(ctx context.Context, querier dbxInternal) (bool, error) {
+	if s == nil {
+		return sqliteVersionHasWindow(ctx, querier)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.window == nil {
+		window, err := sqliteVersionHasWindow(ctx, querier)
+		if err != nil {
+			return false, err
+		}
+
+		s.window = &window
+	}
+
+	return *s.window, nil
+}
+
+func sqliteVersionHasWindow(ctx context.Context, querier dbxInternal) (bool, error) {
+	var version string
+	if err := queryRowx(ctx, querier, "Select sqlite_version()").Scan(&version); err != nil {
+		return false, err
+	}
+
+	return sqliteHasWindow(version), nil
+}
+
+// sqliteHasWindow tells whether a sqlite version supports window functions, added in 3.25.0
+func sqliteHasWindow(version string) bool {
+	var major, minor int
+	fmt.Sscanf(version, "%d.%d", &major, &minor)
+
+	return major > 3 || major == 3 && minor >= 25
+}
+
+// countRows returns the number of rows query returns
+func countRows(ctx context.Context, querier dbxInternal, query string, args []interface{}) (int64, error) {
+	query, lock := splitLockingClause(trimSemiColumn(query))
+	if lock != "" {
+		return 0, &WrongTypeErr{"can't count the rows of a locking query"}
+	}
+
+	var total int64
+	err := queryRowx(ctx, querier, fmt.Sprintf("Select count(*) From (%s) As dbx_count", query), args...).Scan(&total)
+
+	return total, err
+}
+
+// withTotalColumn adds the count(*) Over() window to the select list of query. The query isn't wrapped in a
+// subquery, whose Order By the outer select wouldn't have to keep, so a page is ordered as with countRows.
+// It returns false when the window can't count the rows: compound selects, Select Distinct, which removes
+// duplicates after the window counted them, or a query it can't find the select list of.
+func withTotalColumn(query string) (string, bool) {
+	words := topLevelWords(query)
+	selectAt, fromAt := -1, -1
+
+	for i, w := range words {
+		switch w.word {
+		case "union", "intersect", "except":
+			return query, false
+		case "select":
+			if selectAt < 0 {
+				selectAt = i
+			}
+		case "from":
+			if selectAt >= 0 && fromAt < 0 {
+				fromAt = i
+			}
+		}
+	}
+
+	if selectAt < 0 || fromAt < 0 || words[selectAt+1].word == "distinct" {
+		return query, false
+	}
+
+	from := words[fromAt].start
+	return fmt.Sprintf("%s, count(*) Over() As %s %s", strings.TrimRight(query[:from], " \t\r\n"), pageTotalColumn, query[from:]), true
+}
+
+// selectWithTotal appends the rows of the page to slice and returns the total counted by the window
+// column of query
+func selectWithTotal(ctx context.Context, querier dbxInternal, slice reflect.Value, query string, opt QueryOption, args []interface{}) (int64, error) {
+	query, args, err := paginate(querier.driverName(), opt, query, args)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := queryX(ctx, querier, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	t := slice.Type().Elem()
+	base := t
+	if base.Kind() == reflect.Ptr {
+		base = base.Elem()
+	}
+
+	scannable := base.Kind() != reflect.Struct || reflect.PtrTo(base).Implements(scannerType)
+	if scannable && len(columns) != 2 {
+		return 0, &WrongTypeErr{fmt.Sprintf("scannable dest slice expects 1 column, got %d", len(columns)-1)}
+	}
+
+	var traversals [][]int
+	if !scannable {
+		traversals = rows.Mapper.TraversalsByName(base, columns)
+	}
+
+	var total int64
+	values := make([]interface{}, len(columns))
+
+	for rows.Next() {
+		item := reflect.New(base)
+
+		for i, column := range columns {
+			switch {
+			case column == pageTotalColumn:
+				values[i] = &total
+			case scannable:
+				values[i] = item.Interface()
+			case len(traversals[i]) == 0:
+				return 0, &MissingParamErr{fmt.Sprintf("missing destination name %s in %s", column, t)}
+			default:
+				values[i] = reflectx.FieldByIndexes(item.Elem(), traversals[i]).Addr().Interface()
+			}
+		}
+
+		if err := rows.Scan(values...); err != nil {
+			return 0, err
+		}
+
+		if t.Kind() != reflect.Ptr {
+			item = item.Elem()
+		}
+
+		slice.Set(reflect.Append(slice, item))
+	}
+
+	return total, ClassifyError(rows.Err())
+}
@@ -0,0 +1,256 @@
+package dbx
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type pagePerson struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func Test_SelectPage_Window(t *testing.T) {
+	dbx, fdb := newFakeDBX(PostgresDriver)
+	fdb.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+		return &fakeRows{
+			cols: []string{"id", "name", "dbx_total"},
+			rows: [][]driver.Value{{int64(3), "Gamma", int64(5)}, {int64(4), "Delta", int64(5)}},
+		}, nil
+	}
+
+	var people []pagePerson
+	res, err := dbx.SelectPage(context.Background(), &people, "Select id, name From person Where age > ?;", NewPageOption(2, 2), 18)
+	require.NoError(t, err)
+
+	require.Equal(t, []pagePerson{{3, "Gamma"}, {4, "Delta"}}, people)
+	require.Equal(t, PageResult{Total: 5, Page: 2, PageSize: 2, HasNext: true}, res)
+	require.Equal(t, []string{"Select id, name, count(*) Over() As dbx_total From person Where age > $1 Limit $2 Offset $3"}, fdb.log())
+}
+
+func Test_SelectPage_WindowPastTheEnd(t *testing.T) {
+	dbx, fdb := newFakeDBX(Sqlite3Driver)
+	fdb.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+		if query == "Select sqlite_version()" {
+			return &fakeRows{cols: []string{"version"}, rows: [][]driver.Value{{"3.31.1"}}}, nil
+		}
+
+		if strings.HasPrefix(query, "Select count(*)") {
+			return &fakeRows{cols: []string{"count"}, rows: [][]driver.Value{{int64(5)}}}, nil
+		}
+
+		return &fakeRows{cols: []string{"name", "dbx_total"}}, nil
+	}
+
+	var names []*string
+	res, err := dbx.SelectPage(context.Background(), &names, "Select name From person", NewPageOption(4, 2))
+	require.NoError(t, err)
+
+	require.Empty(t, names)
+	require.Equal(t, PageResult{Total: 5, Page: 4, PageSize: 2, HasNext: false}, res)
+	require.Equal(t, []string{
+		"Select sqlite_version()",
+		"Select name, count(*) Over() As dbx_total From person Limit ? Offset ?",
+		"Select count(*) From (Select name From person) As dbx_count",
+	}, fdb.log())
+}
+
+func Test_SelectPage_OldSqliteCount(t *testing.T) {
+	dbx, fdb := newFakeDBX(Sqlite3Driver)
+	fdb.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+		switch {
+		case query == "Select sqlite_version()":
+			return &fakeRows{cols: []string{"version"}, rows: [][]driver.Value{{"3.24.0"}}}, nil
+		case strings.HasPrefix(query, "Select count(*)"):
+			return &fakeRows{cols: []string{"count(*)"}, rows: [][]driver.Value{{int64(3)}}}, nil
+		}
+
+		return &fakeRows{cols: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), "Alpha"}, {int64(2), "Beta"}}}, nil
+	}
+
+	// rows are appended to dest, HasNext only counts those of the page
+	people := []pagePerson{{9, "Omega"}}
+	res, err := dbx.SelectPage(context.Background(), &people, "Select id, name From person", NewPageOption(1, 2))
+	require.NoError(t, err)
+
+	require.Equal(t, []pagePerson{{9, "Omega"}, {1, "Alpha"}, {2, "Beta"}}, people)
+	require.Equal(t, PageResult{Total: 3, Page: 1, PageSize: 2, HasNext: true}, res)
+	require.Equal(t, []string{
+		"Select sqlite_version()",
+		"Select count(*) From (Select id, name From person) As dbx_count",
+		"Select id, name From person Limit ? Offset ?",
+	}, fdb.log())
+}
+
+func Test_SelectPage_SameOrder(t *testing.T) {
+	// the page is ordered the same whether the rows are counted by the window or a separate query
+	pageQuery := func(version string) string {
+		dbx, fdb := newFakeDBX(Sqlite3Driver)
+		fdb.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+			switch {
+			case query == "Select sqlite_version()":
+				return &fakeRows{cols: []string{"version"}, rows: [][]driver.Value{{version}}}, nil
+			case strings.HasPrefix(query, "Select count(*)"):
+				return &fakeRows{cols: []string{"count(*)"}, rows: [][]driver.Value{{int64(1)}}}, nil
+			case strings.Contains(query, "dbx_total"):
+				return &fakeRows{cols: []string{"id", "name", "dbx_total"}, rows: [][]driver.Value{{int64(1), "Alpha", int64(1)}}}, nil
+			}
+
+			return &fakeRows{cols: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), "Alpha"}}}, nil
+		}
+
+		opt, err := NewPageOption(1, 10).WithOrder(SortKey{Column: "id", Desc: true})
+		require.NoError(t, err)
+
+		var people []pagePerson
+		_, err = dbx.SelectPage(context.Background(), &people, "Select p.id, p.name From person p Where p.age > ? Order By p.name", opt, 18)
+		require.NoError(t, err)
+
+		log := fdb.log()
+		return log[len(log)-1]
+	}
+
+	require.Equal(t, "Select p.id, p.name From person p Where p.age > ? Order By p.name, id Desc Limit ? Offset ?", pageQuery("3.24.0"))
+	require.Equal(t, "Select p.id, p.name, count(*) Over() As dbx_total From person p Where p.age > ? Order By p.name, id Desc Limit ? Offset ?", pageQuery("3.25.0"))
+}
+
+func Test_withTotalColumn(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+		ok       bool
+	}{
+		{
+			query:    "Select * From person Order By name",
+			expected: "Select *, count(*) Over() As dbx_total From person Order By name",
+			ok:       true,
+		},
+		{
+			query:    "Select id, (Select max(at) From visit v Where v.person_id = p.id) As last_visit\nFROM person p",
+			expected: "Select id, (Select max(at) From visit v Where v.person_id = p.id) As last_visit, count(*) Over() As dbx_total FROM person p",
+			ok:       true,
+		},
+		{
+			query:    "With adult As (Select * From person Where age > 18) Select name From adult",
+			expected: "With adult As (Select * From person Where age > 18) Select name, count(*) Over() As dbx_total From adult",
+			ok:       true,
+		},
+		{
+			query:    "Select 'a from b' As label, name From person -- from (",
+			expected: "Select 'a from b' As label, name, count(*) Over() As dbx_total From person -- from (",
+			ok:       true,
+		},
+		{query: "Select Distinct name From person", ok: false},
+		{query: "Select name From person Union Select name From customer", ok: false},
+		{query: "Select 1", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, ok := withTotalColumn(tt.query)
+			require.Equal(t, tt.ok, ok)
+			if ok {
+				require.Equal(t, tt.expected, query)
+			}
+		})
+	}
+}
+
+func Test_SelectPage_SqliteVersionOnce(t *testing.T) {
+	dbx, fdb := newFakeDBX(Sqlite3Driver)
+	versionErr := errors.New("database is locked")
+	fdb.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+		if query == "Select sqlite_version()" {
+			if versionErr != nil {
+				return nil, versionErr
+			}
+
+			return &fakeRows{cols: []string{"version"}, rows: [][]driver.Value{{"3.45.1"}}}, nil
+		}
+
+		return &fakeRows{cols: []string{"name", "dbx_total"}, rows: [][]driver.Value{{"Alpha", int64(1)}}}, nil
+	}
+
+	// a failed check isn't cached
+	var names []string
+	_, err := dbx.SelectPage(context.Background(), &names, "Select name From person", NewPageOption(1, 2))
+	require.True(t, errors.Is(err, versionErr), err)
+
+	versionErr = nil
+	for i := 0; i < 2; i++ {
+		_, err = dbx.SelectPage(context.Background(), &names, "Select name From person", NewPageOption(1, 2))
+		require.NoError(t, err)
+	}
+
+	tx, err := dbx.BeginTxx(context.Background(), nil)
+	require.NoError(t, err)
+	_, err = tx.SelectPage(context.Background(), &names, "Select name From person", NewPageOption(1, 2))
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	checks := 0
+	for _, stmt := range fdb.log() {
+		if stmt == "Select sqlite_version()" {
+			checks++
+		}
+	}
+	require.Equal(t, 2, checks)
+}
+
+func Test_sqliteHasWindow(t *testing.T) {
+	require.True(t, sqliteHasWindow("3.25.0"))
+	require.True(t, sqliteHasWindow("3.45.1"))
+	require.True(t, sqliteHasWindow("4.0.0"))
+	require.False(t, sqliteHasWindow("3.24.0"))
+	require.False(t, sqliteHasWindow("3.8.11"))
+}
+
+func Test_SelectPage_MysqlCount(t *testing.T) {
+	dbx, fdb := newFakeDBX(MysqlDriver)
+	fdb.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+		if strings.HasPrefix(query, "Select count(*)") {
+			return &fakeRows{cols: []string{"count(*)"}, rows: [][]driver.Value{{int64(3)}}}, nil
+		}
+
+		return &fakeRows{cols: []string{"id", "name"}, rows: [][]driver.Value{{int64(3), "Gamma"}}}, nil
+	}
+
+	var people []*pagePerson
+	res, err := dbx.SelectPage(context.Background(), &people, "Select id, name From person", NewPageOption(2, 2))
+	require.NoError(t, err)
+
+	require.Equal(t, []*pagePerson{{3, "Gamma"}}, people)
+	require.Equal(t, PageResult{Total: 3, Page: 2, PageSize: 2, HasNext: false}, res)
+	require.Equal(t, []string{
+		"Select count(*) From (Select id, name From person) As dbx_count",
+		"Select id, name From person Limit ?, ?",
+	}, fdb.log())
+}
+
+func Test_SelectPage_Errors(t *testing.T) {
+	dbx, fdb := newFakeDBX(PostgresDriver)
+	fdb.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+		return &fakeRows{cols: []string{"id", "age", "dbx_total"}, rows: [][]driver.Value{{int64(1), int64(30), int64(1)}}}, nil
+	}
+
+	var people []pagePerson
+	_, err := dbx.SelectPage(context.Background(), &people, "Select id, age From person", NewPageOption(1, 10))
+	require.Equal(t, &MissingParamErr{"missing destination name age in dbx.pagePerson"}, err)
+
+	_, err = dbx.SelectPage(context.Background(), &people, "Select id From person For Update", NewPageOption(1, 10))
+	require.Equal(t, &WrongTypeErr{"can't count the rows of a locking query"}, err)
+
+	_, err = dbx.SelectPage(context.Background(), people, "Select id From person", NewPageOption(1, 10))
+	require.Equal(t, &WrongTypeErr{"dest must be a pointer to a slice"}, err)
+
+	keyset, err := NewKeysetOption([]SortKey{{Column: "id"}}, "", 10)
+	require.NoError(t, err)
+
+	_, err = dbx.SelectPage(context.Background(), &people, "Select id From person", keyset)
+	require.Equal(t, &WrongTypeErr{"SelectPage doesn't support keyset pagination"}, err)
+}
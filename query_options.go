@@ -1,92 +1,450 @@
 package dbx
 
 import (
+	"fmt"
 	"regexp"
+	"strings"
 )
 
 const (
 	qTypePage   = 1
 	qTypeOffset = 2
+	qTypeKeyset = 3
 )
 
-var regEndSemiCol = regexp.MustCompile("(;\\s*)$")
+var (
+	regEndSemiCol    = regexp.MustCompile("(;\\s*)$")
+	regOrderBy       = regexp.MustCompile(`(?i)\border\s+by\b`)
+	regLockingClause = regexp.MustCompile(`(?i)(\s+for\s+(update|share|no\s+key\s+update|key\s+share)(\s+of\s+[\w\s.,"]+?)?(\s+(nowait|skip\s+locked))?|\s+lock\s+in\s+share\s+mode)\s*$`)
+)
+
+// PageLimits holds the page size used when none is given, and the largest page size allowed
+type PageLimits struct {
+	defaultSize int
+	maxSize     int
+}
+
+// DefaultPageLimits are the limits of the options built by NewPageOption, NewOffsetOption and
+// NewKeysetOption: pages of 25 rows by default, with no maximum
+var DefaultPageLimits = PageLimits{defaultSize: 25}
+
+// NewPageLimits returns page limits defaulting to defaultSize rows per page, and clamping larger sizes
+// to maxSize. A maxSize of 0 allows any size.
+func NewPageLimits(defaultSize int, maxSize int) (PageLimits, error) {
+	if defaultSize < 1 {
+		return PageLimits{}, &WrongTypeErr{fmt.Sprintf("default page size must be positive, got %d", defaultSize)}
+	}
+
+	if maxSize < 0 || (maxSize > 0 && maxSize < defaultSize) {
+		return PageLimits{}, &WrongTypeErr{fmt.Sprintf("max page size %d is lower than the default page size %d", maxSize, defaultSize)}
+	}
+
+	return PageLimits{defaultSize: defaultSize, maxSize: maxSize}, nil
+}
+
+// PageOption returns an option selecting the given page of size rows, the first page being 1
+func (l PageLimits) PageOption(page int, size int) QueryOption {
+	return QueryOption{qType: qTypePage, limits: l, limit: l.clamp(size)}.WithPage(page)
+}
+
+// OffsetOption returns an option selecting limit rows from offset
+func (l PageLimits) OffsetOption(offset int, limit int) QueryOption {
+	return QueryOption{qType: qTypeOffset, limits: l, limit: l.clamp(limit)}.WithOffset(offset)
+}
+
+// clamp returns size, or the default size when not positive, capped to the max size
+func (l PageLimits) clamp(size int) int {
+	if l.defaultSize < 1 {
+		l = DefaultPageLimits
+	}
 
+	if size < 1 {
+		size = l.defaultSize
+	}
+
+	if l.maxSize > 0 && size > l.maxSize {
+		size = l.maxSize
+	}
+
+	return size
+}
+
+// QueryOption describes the page of a query's rows to select. Its methods return new options,
+// the receiver is never modified.
 type QueryOption struct {
 	qType  int32
 	page   int
 	offset int
 	limit  int
+	limits PageLimits
+
+	// keys and after define a keyset page: the rows ordered by keys that follow the values after
+	keys  []SortKey
+	after []interface{}
+
+	// order lists the keys an offset or page option orders the rows by
+	order []SortKey
 }
 
+// NewPageOption returns an option selecting the given page of length rows within DefaultPageLimits
 func NewPageOption(page int, length int) QueryOption {
-	offset := getOffsetFromPageAndLimit(page, length, 25)
+	return DefaultPageLimits.PageOption(page, length)
+}
+
+// NewOffsetOption returns an option selecting limit rows from offset within DefaultPageLimits
+func NewOffsetOption(offset int, limit int) QueryOption {
+	return DefaultPageLimits.OffsetOption(offset, limit)
+}
+
+// WithPage returns the option selecting the given page, the first page being 1
+func (qo QueryOption) WithPage(page int) QueryOption {
+	if page < 1 {
+		page = 1
+	}
+
+	qo.page = page
+	qo.offset = getOffsetFromPageAndLimit(page, qo.Limit())
+
+	return qo
+}
 
-	return QueryOption{
-		qType:  qTypePage,
-		page:   page,
-		limit:  length,
-		offset: offset,
+// WithOffset returns the option selecting the rows from offset
+func (qo QueryOption) WithOffset(offset int) QueryOption {
+	if offset < 0 {
+		offset = 0
 	}
+
+	qo.offset = offset
+	qo.page = getPageFromOffsetAndLimit(offset, qo.Limit())
+
+	return qo
 }
 
-func NewOffsetOption(offset int, limit int) QueryOption {
-	page := getPageFromOffsetAndLimit(offset, limit, 25)
+// WithLimit returns the option selecting limit rows from the same offset, clamped to the option's page limits
+func (qo QueryOption) WithLimit(limit int) QueryOption {
+	qo.limit = qo.limits.clamp(limit)
+
+	if qo.qType == qTypePage {
+		return qo.WithPage(qo.page)
+	}
+
+	return qo.WithOffset(qo.offset)
+}
+
+// Next returns the option selecting the following page. Keyset options are returned as is,
+// the next page of a keyset is selected with a new cursor.
+func (qo QueryOption) Next() QueryOption {
+	switch qo.qType {
+	case qTypeKeyset:
+		return qo
+	case qTypeOffset:
+		return qo.WithOffset(qo.offset + qo.Limit())
+	}
+
+	return qo.WithPage(qo.Page() + 1)
+}
 
-	return QueryOption{
-		qType:  qTypePage,
-		page:   page,
-		limit:  limit,
-		offset: offset,
+// Prev returns the option selecting the previous page, or the first page
+func (qo QueryOption) Prev() QueryOption {
+	switch qo.qType {
+	case qTypeKeyset:
+		return qo
+	case qTypeOffset:
+		return qo.WithOffset(qo.offset - qo.Limit())
 	}
+
+	return qo.WithPage(qo.Page() - 1)
 }
 
-func (qo QueryOption) IncPage(inc int) {
-	qo.page += inc
-	qo.offset = getOffsetFromPageAndLimit(qo.page, qo.limit, 25)
+// IncPage returns the option inc pages further
+//
+// Deprecated: use WithPage, Next or Prev
+func (qo QueryOption) IncPage(inc int) QueryOption {
+	return qo.WithPage(qo.Page() + inc)
 }
 
-func (qo QueryOption) IncOffset(inc int) {
-	qo.offset += inc
-	qo.page = getPageFromOffsetAndLimit(qo.offset, qo.limit, 25)
+// IncOffset returns the option inc rows further
+//
+// Deprecated: use WithOffset
+func (qo QueryOption) IncOffset(inc int) QueryOption {
+	return qo.WithOffset(qo.offset + inc)
 }
 
+// Page returns the page holding the first selected row, the first page being 1
 func (qo QueryOption) Page() int {
+	if qo.page < 1 {
+		return 1
+	}
+
 	return qo.page
 }
 
+// Offset returns the number of rows skipped
+func (qo QueryOption) Offset() int {
+	return qo.offset
+}
+
+// Limit returns the number of rows selected
+func (qo QueryOption) Limit() int {
+	return qo.limits.clamp(qo.limit)
+}
+
+// WithOptions appends the pagination of the first option to query as Offset ? Limit ?, binding the offset
+// then the limit. Mysql rejects that order, use DBX.WithOptions to render it for the connection's driver.
 func WithOptions(option []QueryOption, query string, args ...interface{}) (string, []interface{}) {
 	if len(option) == 0 {
 		return query, args
 	}
 
-	query = trimSemiColumn(query)
+	query, args, _ = paginate("", option[0], query, args)
+	return query, args
+}
 
-	query += " Offset ? Limit ?"
-	args = append(args, option[0].offset, option[0].limit)
+// WithOptions appends the ordering and pagination of the first option to query, rendered for the driver,
+// before any trailing locking clause like For Update. A query with a Limit or Offset of its own is rejected.
+func (dbx *DBX) WithOptions(option []QueryOption, query string, args ...interface{}) (string, []interface{}, error) {
+	if len(option) == 0 {
+		return query, args, nil
+	}
 
-	return query, args
+	return paginate(dbx.driver, option[0], query, args)
+}
+
+func (tx *Tx) WithOptions(option []QueryOption, query string, args ...interface{}) (string, []interface{}, error) {
+	if len(option) == 0 {
+		return query, args, nil
+	}
+
+	return paginate(tx.driver, option[0], query, args)
+}
+
+// WithOrder returns a copy of qo ordering the rows by keys, after any Order By already in the query.
+// Use ParseSortKeys to build keys from user input.
+func (qo QueryOption) WithOrder(keys ...SortKey) (QueryOption, error) {
+	if qo.qType == qTypeKeyset {
+		return qo, &WrongTypeErr{"keyset pagination is already ordered by its sort keys"}
+	}
+
+	for _, k := range keys {
+		if !regSortColumn.MatchString(k.Column) {
+			return qo, &WrongTypeErr{fmt.Sprintf("invalid sort column '%s'", k.Column)}
+		}
+	}
+
+	qo.order = append(append([]SortKey{}, qo.order...), keys...)
+	return qo, nil
+}
+
+// ParseSortKeys parses user supplied sort specs, eg. "name", "name desc" or "-created_at", and rejects
+// the columns that aren't in sortable
+func ParseSortKeys(sortable []string, specs ...string) ([]SortKey, error) {
+	keys := make([]SortKey, 0, len(specs))
+
+	for _, spec := range specs {
+		fields := strings.Fields(spec)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, &WrongTypeErr{fmt.Sprintf("invalid sort spec '%s'", spec)}
+		}
+
+		key := SortKey{Column: fields[0]}
+		if strings.HasPrefix(key.Column, "-") {
+			key.Column, key.Desc = key.Column[1:], true
+		}
+
+		if len(fields) == 2 {
+			switch strings.ToLower(fields[1]) {
+			case "asc":
+			case "desc":
+				key.Desc = !key.Desc
+			default:
+				return nil, &WrongTypeErr{fmt.Sprintf("invalid sort direction in '%s'", spec)}
+			}
+		}
+
+		if !containsString(sortable, key.Column) {
+			return nil, &WrongTypeErr{fmt.Sprintf("column '%s' is not sortable", key.Column)}
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// paginate appends the order and limit of qo to query. An empty driver renders the clause every
+// supported driver accepts.
+func paginate(driver string, qo QueryOption, query string, args []interface{}) (string, []interface{}, error) {
+	limitClause, limitArgs, err := limitOffsetClause(driver, qo.Limit(), qo.offset)
+	if err != nil {
+		return "", nil, err
+	}
+
+	query, lock := splitLockingClause(trimSemiColumn(query))
+
+	if qo.qType == qTypeKeyset {
+		query, args = withKeyset(qo, query, args)
+		return query + lock, args, nil
+	}
+
+	// WithOptions without a driver can't report the error, it appends its clause as it always did
+	if driver != "" && hasLimit(query) {
+		return "", nil, &WrongTypeErr{"can't paginate a query that already has a Limit or Offset"}
+	}
+
+	if len(qo.order) > 0 {
+		if hasOrderBy(query) {
+			query += ", " + orderByKeys(qo.order)
+		} else {
+			query += " Order By " + orderByKeys(qo.order)
+		}
+	}
+
+	query += limitClause
+	args = append(args, limitArgs...)
+
+	return query + lock, args, nil
+}
+
+// limitOffsetClause returns the pagination clause of the driver and its args, in binding order.
+// Without a driver, it renders the Offset ? Limit ? clause WithOptions always emitted.
+func limitOffsetClause(driver string, limit, offset int) (string, []interface{}, error) {
+	switch driver {
+	case "":
+		return " Offset ? Limit ?", []interface{}{offset, limit}, nil
+	case PgxDriver, PostgresDriver, Sqlite3Driver:
+		return " Limit ? Offset ?", []interface{}{limit, offset}, nil
+	case MysqlDriver:
+		return " Limit ?, ?", []interface{}{offset, limit}, nil
+	}
+
+	return "", nil, fmt.Errorf("driver %s not supported", driver)
+}
+
+// splitLockingClause separates a trailing locking clause, eg. For Update Skip Locked, from query
+func splitLockingClause(query string) (string, string) {
+	loc := regLockingClause.FindStringIndex(query)
+	if loc == nil {
+		return query, ""
+	}
+
+	return query[:loc[0]], query[loc[0]:]
+}
+
+// hasOrderBy tells whether query ends with an Order By of its own, as opposed to one in a subquery
+func hasOrderBy(query string) bool {
+	locs := regOrderBy.FindAllStringIndex(query, -1)
+	if len(locs) == 0 {
+		return false
+	}
+
+	tail := query[locs[len(locs)-1][1]:]
+	return strings.Count(tail, "(") == strings.Count(tail, ")")
+}
+
+// hasLimit tells whether query ends with a Limit, Offset or Fetch clause of its own, as opposed to one in
+// a subquery
+func hasLimit(query string) bool {
+	words := topLevelWords(query)
+
+	for i, w := range words {
+		switch w.word {
+		case "limit", "offset":
+			// a column named limit or offset isn't followed by a count
+			rest := strings.TrimLeft(query[w.start+len(w.word):], " \t\r\n")
+			if rest != "" && strings.IndexByte("0123456789?$:@", rest[0]) >= 0 {
+				return true
+			}
+		case "fetch":
+			if i+1 < len(words) && (words[i+1].word == "first" || words[i+1].word == "next") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type sqlWord struct {
+	word  string
+	start int
+}
+
+// topLevelWords returns the lower cased keywords and identifiers of query outside of parentheses,
+// quotes and comments
+func topLevelWords(query string) []sqlWord {
+	var words []sqlWord
+	depth := 0
+
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == '\'' || c == '"' || c == '`':
+			if end := strings.IndexByte(query[i+1:], c); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(query)
+			}
+		case strings.HasPrefix(query[i:], "--"):
+			if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(query)
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i:], "*/"); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(query)
+			}
+		case isWordByte(c):
+			start := i
+			for i+1 < len(query) && isWordByte(query[i+1]) {
+				i++
+			}
+
+			if depth == 0 {
+				words = append(words, sqlWord{strings.ToLower(query[start : i+1]), start})
+			}
+		}
+	}
+
+	return words
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
 }
 
 func trimSemiColumn(query string) string {
 	return regEndSemiCol.ReplaceAllString(query, "")
 }
 
-func getOffsetFromPageAndLimit(page, limit, defaultLimit int) int {
+func getOffsetFromPageAndLimit(page, limit int) int {
 	if page < 1 {
 		page = 1
 	}
 
-	if limit < 1 {
-		limit = defaultLimit
-	}
-
 	return (page - 1) * limit
 }
 
-func getPageFromOffsetAndLimit(offset, limit, defaultLimit int) int {
-	if offset < 1 || offset <= defaultLimit {
+// getPageFromOffsetAndLimit returns the page holding the row at offset
+func getPageFromOffsetAndLimit(offset, limit int) int {
+	if offset < 1 {
 		return 1
 	}
 
-	return (offset + limit) / limit
+	return offset/limit + 1
 }
@@ -1,6 +1,7 @@
 package dbx
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/require"
 	"testing"
 )
@@ -43,3 +44,274 @@ func Test_trimSemilColumn(t *testing.T) {
 		require.Equal(t, test.expected, actual)
 	}
 }
+
+func Test_paginate(t *testing.T) {
+	byName := []SortKey{{Column: "name"}, {Column: "id", Desc: true}}
+
+	tests := []struct {
+		name          string
+		driver        string
+		order         []SortKey
+		query         string
+		expectedQuery string
+		expectedArgs  []interface{}
+		expectedErr   error
+	}{
+		{
+			name:          "Without a driver",
+			query:         "Select * From t Where a = ?",
+			expectedQuery: "Select * From t Where a = ? Offset ? Limit ?",
+			expectedArgs:  []interface{}{1, 20, 10},
+		},
+		{
+			name:          "Postgres",
+			driver:        PgxDriver,
+			query:         "Select * From t Where a = ?;",
+			expectedQuery: "Select * From t Where a = ? Limit ? Offset ?",
+		},
+		{
+			name:          "Mysql",
+			driver:        MysqlDriver,
+			query:         "Select * From t Where a = ?",
+			expectedQuery: "Select * From t Where a = ? Limit ?, ?",
+			expectedArgs:  []interface{}{1, 20, 10},
+		},
+		{
+			name:          "Sqlite with order",
+			driver:        Sqlite3Driver,
+			order:         byName,
+			query:         "Select * From t Where a = ?",
+			expectedQuery: "Select * From t Where a = ? Order By name, id Desc Limit ? Offset ?",
+		},
+		{
+			name:          "Appended to an existing order",
+			driver:        PostgresDriver,
+			order:         byName,
+			query:         "Select * From t Where a = ? ORDER BY created_at",
+			expectedQuery: "Select * From t Where a = ? ORDER BY created_at, name, id Desc Limit ? Offset ?",
+		},
+		{
+			name:          "Order in a subquery",
+			driver:        PostgresDriver,
+			order:         byName,
+			query:         "Select * From (Select * From t Order By b Limit 5) s Where a = ?",
+			expectedQuery: "Select * From (Select * From t Order By b Limit 5) s Where a = ? Order By name, id Desc Limit ? Offset ?",
+		},
+		{
+			name:          "Before a locking clause",
+			driver:        PostgresDriver,
+			query:         "Select * From t Where a = ? For Update Skip Locked;",
+			expectedQuery: "Select * From t Where a = ? Limit ? Offset ? For Update Skip Locked",
+		},
+		{
+			name:          "Before a mysql locking clause",
+			driver:        MysqlDriver,
+			query:         "Select * From t Where a = ? LOCK IN SHARE MODE",
+			expectedQuery: "Select * From t Where a = ? Limit ?, ? LOCK IN SHARE MODE",
+			expectedArgs:  []interface{}{1, 20, 10},
+		},
+		{
+			name:        "Query with a limit",
+			driver:      PostgresDriver,
+			order:       byName,
+			query:       "Select * From t Where a = ? Limit 5",
+			expectedErr: &WrongTypeErr{"can't paginate a query that already has a Limit or Offset"},
+		},
+		{
+			name:        "Query with a mysql limit",
+			driver:      MysqlDriver,
+			query:       "Select * From t Where a = ? LIMIT 10, 5",
+			expectedErr: &WrongTypeErr{"can't paginate a query that already has a Limit or Offset"},
+		},
+		{
+			name:        "Query with a fetch clause",
+			driver:      PostgresDriver,
+			query:       "Select * From t Where a = ? Offset ? Rows Fetch Next 5 Rows Only",
+			expectedErr: &WrongTypeErr{"can't paginate a query that already has a Limit or Offset"},
+		},
+		{
+			name:          "Column named offset",
+			driver:        PostgresDriver,
+			order:         []SortKey{{Column: "offset"}},
+			query:         "Select \"limit\", offset From t Where offset > ?",
+			expectedQuery: "Select \"limit\", offset From t Where offset > ? Order By offset Limit ? Offset ?",
+		},
+		{
+			name:        "Unsupported driver",
+			driver:      "oracle",
+			query:       "Select * From t Where a = ?",
+			expectedErr: fmt.Errorf("driver oracle not supported"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opt, err := NewPageOption(3, 10).WithOrder(test.order...)
+			require.NoError(t, err)
+
+			query, args, err := paginate(test.driver, opt, test.query, []interface{}{1})
+			if test.expectedErr != nil {
+				require.Equal(t, test.expectedErr, err)
+				return
+			}
+
+			if test.expectedArgs == nil {
+				test.expectedArgs = []interface{}{1, 10, 20}
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expectedQuery, query)
+			require.Equal(t, test.expectedArgs, args)
+		})
+	}
+}
+
+func Test_ParseSortKeys(t *testing.T) {
+	sortable := []string{"name", "created_at"}
+
+	tests := []struct {
+		name         string
+		specs        []string
+		expectedKeys []SortKey
+		expectedErr  error
+	}{
+		{
+			name:         "Directions",
+			specs:        []string{"name", "created_at DESC", "-name", "-name desc", "name asc"},
+			expectedKeys: []SortKey{{"name", false}, {"created_at", true}, {"name", true}, {"name", false}, {"name", false}},
+		},
+		{
+			name:        "Column not sortable",
+			specs:       []string{"password"},
+			expectedErr: &WrongTypeErr{"column 'password' is not sortable"},
+		},
+		{
+			name:        "Injection",
+			specs:       []string{"name; Drop Table t"},
+			expectedErr: &WrongTypeErr{"invalid sort spec 'name; Drop Table t'"},
+		},
+		{
+			name:        "Invalid direction",
+			specs:       []string{"name sideways"},
+			expectedErr: &WrongTypeErr{"invalid sort direction in 'name sideways'"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys, err := ParseSortKeys(sortable, test.specs...)
+			require.Equal(t, test.expectedErr, err)
+			if err == nil {
+				require.Equal(t, test.expectedKeys, keys)
+			}
+		})
+	}
+}
+
+func Test_DBX_WithOptions_Keyset(t *testing.T) {
+	dbx, _ := newFakeDBX(PostgresDriver)
+
+	opt, err := NewKeysetOption([]SortKey{{Column: "id"}}, "", 10)
+	require.NoError(t, err)
+
+	_, err = opt.WithOrder(SortKey{Column: "name"})
+	require.Error(t, err)
+
+	query, args, err := dbx.WithOptions([]QueryOption{opt}, "Select * From t For Update")
+	require.NoError(t, err)
+	require.Equal(t, "Select * From (Select * From t) As dbx_page Order By id Limit ? For Update", query)
+	require.Equal(t, []interface{}{10}, args)
+}
+
+func Test_NewPageLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		defaultSize int
+		maxSize     int
+		expectedErr error
+	}{
+		{name: "Without max", defaultSize: 25},
+		{name: "With max", defaultSize: 25, maxSize: 100},
+		{name: "Max equal to default", defaultSize: 25, maxSize: 25},
+		{name: "Zero default", defaultSize: 0, expectedErr: &WrongTypeErr{"default page size must be positive, got 0"}},
+		{name: "Max lower than default", defaultSize: 25, maxSize: 10, expectedErr: &WrongTypeErr{"max page size 10 is lower than the default page size 25"}},
+		{name: "Negative max", defaultSize: 25, maxSize: -1, expectedErr: &WrongTypeErr{"max page size -1 is lower than the default page size 25"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewPageLimits(test.defaultSize, test.maxSize)
+			require.Equal(t, test.expectedErr, err)
+		})
+	}
+}
+
+func Test_QueryOption(t *testing.T) {
+	limits, err := NewPageLimits(10, 50)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		option         QueryOption
+		expectedType   int32
+		expectedPage   int
+		expectedOffset int
+		expectedLimit  int
+	}{
+		{name: "First page", option: NewPageOption(1, 20), expectedType: qTypePage, expectedPage: 1, expectedOffset: 0, expectedLimit: 20},
+		{name: "Third page", option: NewPageOption(3, 20), expectedType: qTypePage, expectedPage: 3, expectedOffset: 40, expectedLimit: 20},
+		{name: "Page zero", option: NewPageOption(0, 20), expectedType: qTypePage, expectedPage: 1, expectedOffset: 0, expectedLimit: 20},
+		{name: "Negative page", option: NewPageOption(-2, 20), expectedType: qTypePage, expectedPage: 1, expectedOffset: 0, expectedLimit: 20},
+		{name: "Default page size", option: NewPageOption(2, 0), expectedType: qTypePage, expectedPage: 2, expectedOffset: 25, expectedLimit: 25},
+		{name: "No max page size", option: NewPageOption(1, 10000), expectedType: qTypePage, expectedPage: 1, expectedOffset: 0, expectedLimit: 10000},
+		{name: "Offset zero", option: NewOffsetOption(0, 10), expectedType: qTypeOffset, expectedPage: 1, expectedOffset: 0, expectedLimit: 10},
+		{name: "Negative offset", option: NewOffsetOption(-5, 10), expectedType: qTypeOffset, expectedPage: 1, expectedOffset: 0, expectedLimit: 10},
+		{name: "Offset within first page", option: NewOffsetOption(9, 10), expectedType: qTypeOffset, expectedPage: 1, expectedOffset: 9, expectedLimit: 10},
+		{name: "Offset starting second page", option: NewOffsetOption(10, 10), expectedType: qTypeOffset, expectedPage: 2, expectedOffset: 10, expectedLimit: 10},
+		{name: "Offset under the default size", option: NewOffsetOption(20, 5), expectedType: qTypeOffset, expectedPage: 5, expectedOffset: 20, expectedLimit: 5},
+		{name: "Offset with default limit", option: NewOffsetOption(50, 0), expectedType: qTypeOffset, expectedPage: 3, expectedOffset: 50, expectedLimit: 25},
+		{name: "Custom default size", option: limits.PageOption(2, 0), expectedType: qTypePage, expectedPage: 2, expectedOffset: 10, expectedLimit: 10},
+		{name: "Clamped to max size", option: limits.PageOption(2, 80), expectedType: qTypePage, expectedPage: 2, expectedOffset: 50, expectedLimit: 50},
+		{name: "Max size", option: limits.OffsetOption(0, 50), expectedType: qTypeOffset, expectedPage: 1, expectedOffset: 0, expectedLimit: 50},
+		{name: "Next page", option: NewPageOption(2, 10).Next(), expectedType: qTypePage, expectedPage: 3, expectedOffset: 20, expectedLimit: 10},
+		{name: "Prev page", option: NewPageOption(2, 10).Prev(), expectedType: qTypePage, expectedPage: 1, expectedOffset: 0, expectedLimit: 10},
+		{name: "Prev of first page", option: NewPageOption(1, 10).Prev(), expectedType: qTypePage, expectedPage: 1, expectedOffset: 0, expectedLimit: 10},
+		{name: "Next offset", option: NewOffsetOption(5, 10).Next(), expectedType: qTypeOffset, expectedPage: 2, expectedOffset: 15, expectedLimit: 10},
+		{name: "Prev offset", option: NewOffsetOption(15, 10).Prev(), expectedType: qTypeOffset, expectedPage: 1, expectedOffset: 5, expectedLimit: 10},
+		{name: "Prev offset within first page", option: NewOffsetOption(5, 10).Prev(), expectedType: qTypeOffset, expectedPage: 1, expectedOffset: 0, expectedLimit: 10},
+		{name: "With page", option: NewOffsetOption(5, 10).WithPage(4), expectedType: qTypeOffset, expectedPage: 4, expectedOffset: 30, expectedLimit: 10},
+		{name: "With offset", option: NewPageOption(4, 10).WithOffset(12), expectedType: qTypePage, expectedPage: 2, expectedOffset: 12, expectedLimit: 10},
+		{name: "With limit on a page", option: NewPageOption(3, 10).WithLimit(20), expectedType: qTypePage, expectedPage: 3, expectedOffset: 40, expectedLimit: 20},
+		{name: "With limit on an offset", option: NewOffsetOption(30, 10).WithLimit(20), expectedType: qTypeOffset, expectedPage: 2, expectedOffset: 30, expectedLimit: 20},
+		{name: "With limit above max", option: limits.PageOption(1, 10).WithLimit(100), expectedType: qTypePage, expectedPage: 1, expectedOffset: 0, expectedLimit: 50},
+		{name: "Inc page", option: NewPageOption(1, 10).IncPage(2), expectedType: qTypePage, expectedPage: 3, expectedOffset: 20, expectedLimit: 10},
+		{name: "Inc offset", option: NewOffsetOption(0, 10).IncOffset(25), expectedType: qTypeOffset, expectedPage: 3, expectedOffset: 25, expectedLimit: 10},
+		{name: "Zero value", option: QueryOption{}, expectedType: 0, expectedPage: 1, expectedOffset: 0, expectedLimit: 25},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expectedType, test.option.qType)
+			require.Equal(t, test.expectedPage, test.option.Page())
+			require.Equal(t, test.expectedOffset, test.option.Offset())
+			require.Equal(t, test.expectedLimit, test.option.Limit())
+		})
+	}
+}
+
+func Test_QueryOption_Immutable(t *testing.T) {
+	opt := NewPageOption(2, 10)
+
+	opt.Next()
+	opt.WithPage(5)
+	opt.WithLimit(50)
+	opt.IncPage(1)
+
+	require.Equal(t, 2, opt.Page())
+	require.Equal(t, 10, opt.Offset())
+	require.Equal(t, 10, opt.Limit())
+
+	keyset, err := NewKeysetOption([]SortKey{{Column: "id"}}, "", 10)
+	require.NoError(t, err)
+	require.Equal(t, keyset, keyset.Next())
+}
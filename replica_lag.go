@@ -0,0 +1,109 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// pgReplicationLagQuery returns the seconds since the last replayed transaction, or 0 when the replica
+// has replayed everything it received, so that an idle primary doesn't look like a lagging replica
+const pgReplicationLagQuery = `Select Case When pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() Then 0
+	Else Coalesce(Extract(Epoch From now() - pg_last_xact_replay_timestamp()), 0) End`
+
+const mysqlReplicaStatusQuery = "Show Slave Status"
+
+// errReplicationStopped is returned by replicationLag when the replica doesn't replicate
+var errReplicationStopped = errors.New("replication is not running")
+
+// checkLag measures the replication lag of every replica, taking out of rotation those lagging more than
+// maxLag or not replicating, and putting them back once they caught up.
+// Replicas whose lag can't be measured keep their state, the health check takes care of unreachable ones.
+func (c *Cluster) checkLag(ctx context.Context, timeout time.Duration, maxLag time.Duration) {
+	for _, r := range c.replicas {
+		lagCtx, cancel := context.WithTimeout(ctx, timeout)
+		lag, err := replicationLag(lagCtx, r.db)
+		cancel()
+
+		switch {
+		case errors.Is(err, errReplicationStopped):
+			if r.setLagging(true) {
+				c.primary.logEvent(LevelReplica, r.name+" stopped replicating, removed from rotation", err)
+			}
+		case err != nil:
+			continue
+		case lag > maxLag:
+			if r.setLagging(true) {
+				c.primary.logEvent(LevelReplica, fmt.Sprintf("%s lags %s behind the primary, removed from rotation", r.name, lag), nil)
+			}
+		default:
+			if r.setLagging(false) {
+				c.primary.logEvent(LevelReplica, fmt.Sprintf("%s caught up to %s behind the primary, back in rotation", r.name, lag), nil)
+			}
+		}
+	}
+}
+
+// replicationLag returns how far behind its primary db replays transactions
+func replicationLag(ctx context.Context, db *DBX) (time.Duration, error) {
+	switch db.driver {
+	case PgxDriver, PostgresDriver:
+		var secs float64
+		if err := db.db.QueryRowxContext(ctx, pgReplicationLagQuery).Scan(&secs); err != nil {
+			return 0, err
+		}
+
+		return time.Duration(secs * float64(time.Second)), nil
+	case MysqlDriver:
+		return mysqlReplicationLag(ctx, db)
+	}
+
+	return 0, fmt.Errorf("driver %s not supported", db.driver)
+}
+
+// mysqlReplicationLag reads Seconds_Behind_Master, or Seconds_Behind_Source on recent versions,
+// which is null when replication is stopped
+func mysqlReplicationLag(ctx context.Context, db *DBX) (time.Duration, error) {
+	rows, err := db.db.QueryxContext(ctx, mysqlReplicaStatusQuery)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+
+		return 0, errReplicationStopped
+	}
+
+	status := map[string]interface{}{}
+	if err := rows.MapScan(status); err != nil {
+		return 0, err
+	}
+
+	behind, ok := status["Seconds_Behind_Master"]
+	if !ok {
+		behind = status["Seconds_Behind_Source"]
+	}
+
+	var secs string
+	switch v := behind.(type) {
+	case nil:
+		return 0, errReplicationStopped
+	case []byte:
+		secs = string(v)
+	default:
+		secs = fmt.Sprint(v)
+	}
+
+	n, err := strconv.ParseFloat(secs, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(n * float64(time.Second)), nil
+}
@@ -0,0 +1,77 @@
+package dbx
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Cluster_CheckLag_Postgres(t *testing.T) {
+	c, _, replicas := newFakeCluster(t, RoundRobin, 2)
+
+	var out bytes.Buffer
+	c.Primary().SetLogger(LogError, &out)
+
+	lags := []float64{0.5, 120}
+	for i, fdb := range replicas {
+		i := i
+		fdb.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+			return &fakeRows{cols: []string{"lag"}, rows: [][]driver.Value{{lags[i]}}}, nil
+		}
+	}
+
+	c.checkLag(context.Background(), time.Second, 10*time.Second)
+	require.Equal(t, []string{pgReplicationLagQuery}, replicas[1].log())
+	require.True(t, c.replicas[0].available())
+	require.False(t, c.replicas[1].available())
+	require.Contains(t, out.String(), `"msg":"replica 2 lags 2m0s behind the primary, removed from rotation"`)
+
+	out.Reset()
+	c.checkLag(context.Background(), time.Second, 10*time.Second)
+	require.Empty(t, out.String())
+
+	lags[1] = 2
+	c.checkLag(context.Background(), time.Second, 10*time.Second)
+	require.True(t, c.replicas[1].available())
+	require.Contains(t, out.String(), `"msg":"replica 2 caught up to 2s behind the primary, back in rotation"`)
+}
+
+func Test_Cluster_CheckLag_Mysql(t *testing.T) {
+	primary, _ := newFakeDBX(MysqlDriver)
+	replica, fdb := newFakeDBX(MysqlDriver)
+
+	c := NewClusterFromDBX(primary, []*DBX{replica}, ClusterOptions{HealthCheckInterval: -1})
+	defer c.Close()
+
+	var out bytes.Buffer
+	primary.SetLogger(LogError, &out)
+
+	var behind driver.Value = []byte("30")
+	fdb.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+		return &fakeRows{
+			cols: []string{"Slave_IO_State", "Seconds_Behind_Master"},
+			rows: [][]driver.Value{{[]byte("Waiting for master to send event"), behind}},
+		}, nil
+	}
+
+	lag, err := replicationLag(context.Background(), replica)
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Second, lag)
+
+	c.checkLag(context.Background(), time.Second, time.Minute)
+	require.True(t, c.replicas[0].available())
+
+	behind = nil
+	c.checkLag(context.Background(), time.Second, time.Minute)
+	require.False(t, c.replicas[0].available())
+	require.Contains(t, out.String(), `"msg":"replica 1 stopped replicating, removed from rotation","exec_time_ns":0,"error_msg":"replication is not running"`)
+	require.Equal(t, mysqlReplicaStatusQuery, fdb.log()[0])
+
+	var dest []int
+	require.NoError(t, c.Select(&dest, "Select 1"))
+	require.Len(t, fdb.log(), 3)
+}
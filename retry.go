@@ -0,0 +1,133 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy describes how many times a failed unit of work is run again and how long to wait in between.
+// The delay doubles after every attempt, starting at BaseDelay and capped at MaxDelay.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+
+	// Jitter waits a random delay between half and all of the computed one, so that the clients
+	// failing together don't retry together
+	Jitter bool
+
+	// Retryable decides whether an error is worth another attempt
+	Retryable func(err error) bool
+}
+
+// DefaultTxRetryPolicy retries transactions aborted by postgres serialization failures (40001),
+// postgres deadlocks (40P01) and mysql deadlocks (1213)
+var DefaultTxRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   20 * time.Millisecond,
+	MaxDelay:    500 * time.Millisecond,
+	Retryable:   isTxConflict,
+}
+
+// DefaultRetryPolicy retries the statements that failed with ErrConnection, eg. while the database fails over
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   50 * time.Millisecond,
+	MaxDelay:    time.Second,
+	Jitter:      true,
+	Retryable:   isConnectionLost,
+}
+
+type retryWritesCtxKey struct{}
+
+// WithRetry returns a context letting the writes run with it be retried by the policy set with SetRetryPolicy.
+// Only use it for idempotent statements, a write may have been applied before its connection was lost.
+func WithRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryWritesCtxKey{}, true)
+}
+
+func retryWrites(ctx context.Context) bool {
+	retry, _ := ctx.Value(retryWritesCtxKey{}).(bool)
+	return retry
+}
+
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+
+	return p.MaxAttempts
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable == nil {
+		return false
+	}
+
+	return p.Retryable(err)
+}
+
+// backoff returns the delay to wait after the given failed attempt (starting at 1)
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter && delay > 1 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+
+	return delay
+}
+
+// isConnectionLost tells whether a statement failed because the database couldn't be reached
+func isConnectionLost(err error) bool {
+	return errors.Is(ClassifyError(err), ErrConnection)
+}
+
+// isRead tells whether a statement run by a read method is safe to retry. Only statements starting with
+// Select, Show or Explain are, anything else may write, eg. an Insert with a Returning clause or a
+// With clause holding a Delete.
+func isRead(query string) bool {
+	switch leadingKeyword(query) {
+	case "SELECT", "SHOW", "EXPLAIN":
+		return true
+	}
+
+	return false
+}
+
+// retryStatement runs a statement again while it fails with an error accepted by the retry policy of querier.
+// Statements of a transaction are never retried, and writes only when ctx comes from WithRetry.
+func retryStatement(ctx context.Context, querier dbxInternal, query string, read bool, run func() error) error {
+	policy := querier.retryPolicy()
+	if !read && !retryWrites(ctx) {
+		return run()
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := run()
+		if err == nil || attempt >= policy.attempts() || !policy.retryable(err) {
+			return err
+		}
+
+		querier.logEvent(LevelRetry, fmt.Sprintf("retrying statement (attempt %d of %d)", attempt+1, policy.attempts()), err)
+		if metrics := querier.getObservers().metrics; metrics != nil {
+			metrics.observeRetry(querier.getDB().Rebind(query))
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(policy.backoff(attempt)):
+		}
+	}
+}
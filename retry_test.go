@@ -0,0 +1,246 @@
+package dbx
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePgError struct {
+	Code string
+}
+
+func (e *fakePgError) Error() string {
+	return "pq: " + e.Code
+}
+
+type fakeMysqlError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *fakeMysqlError) Error() string {
+	return e.Message
+}
+
+func Test_isTxConflict(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "postgres serialization failure", err: &fakePgError{Code: "40001"}, expected: true},
+		{name: "postgres deadlock", err: &fakePgError{Code: "40P01"}, expected: true},
+		{name: "postgres unique violation", err: &fakePgError{Code: "23505"}, expected: false},
+		{name: "wrapped postgres serialization failure", err: errors.Wrap(&fakePgError{Code: "40001"}, "commit"), expected: true},
+		{name: "mysql deadlock", err: &fakeMysqlError{Number: 1213}, expected: true},
+		{name: "mysql duplicate entry", err: &fakeMysqlError{Number: 1062}, expected: false},
+		{name: "plain error", err: errors.New("boom"), expected: false},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, isTxConflict(test.err), test.name)
+	}
+}
+
+func Test_isRead(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected bool
+	}{
+		{query: "select id from a", expected: true},
+		{query: " (Select id From a) Union (Select id From b)", expected: true},
+		{query: "/* report */ Select 1", expected: true},
+		{query: "Show Slave Status", expected: true},
+		{query: "Explain Select 1", expected: true},
+		{query: "Insert Into a (b) Values (1) Returning id", expected: false},
+		{query: "With d As (Delete From a Returning id) Select id From d", expected: false},
+		{query: "Replace Into a (b) Values (1)", expected: false},
+		{query: "Call refresh()", expected: false},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, isRead(test.query), test.query)
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 35 * time.Millisecond}
+
+	require.Equal(t, 10*time.Millisecond, p.backoff(1))
+	require.Equal(t, 20*time.Millisecond, p.backoff(2))
+	require.Equal(t, 35*time.Millisecond, p.backoff(3))
+	require.Equal(t, 35*time.Millisecond, p.backoff(10))
+}
+
+func TestRetryPolicy_backoffJitter(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 35 * time.Millisecond, Jitter: true}
+
+	for i := 0; i < 100; i++ {
+		delay := p.backoff(2)
+		require.True(t, delay >= 10*time.Millisecond && delay <= 20*time.Millisecond, delay)
+	}
+}
+
+func TestDBX_RetryStatement(t *testing.T) {
+	db, fdb := newFakeDBX(PostgresDriver)
+	db.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, Retryable: isConnectionLost})
+	metrics := db.EnableMetrics()
+
+	logs := &bytes.Buffer{}
+	db.SetLogger(LogError, logs)
+
+	connReset := &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}
+	failures := 0
+	fdb.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+		if failures > 0 {
+			failures--
+			return nil, connReset
+		}
+		return &fakeRows{cols: []string{"id"}, rows: [][]driver.Value{{int64(1)}}}, nil
+	}
+	fdb.exec = func(query string, args []driver.NamedValue) (driver.Result, error) {
+		if failures > 0 {
+			failures--
+			return nil, connReset
+		}
+		return driver.RowsAffected(1), nil
+	}
+
+	// retries reads
+	failures = 2
+	var ids []int
+	require.NoError(t, db.Select(&ids, "select id from a"))
+	require.Equal(t, []int{1}, ids)
+	require.Equal(t, []string{"select id from a", "select id from a", "select id from a"}, fdb.log())
+	require.Equal(t, 2, strings.Count(logs.String(), LevelRetry))
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Contains(t, rec.Body.String(), `dbx_query_retries_total{statement="SELECT",fingerprint="select id from a"} 2`)
+
+	// gives up after MaxAttempts
+	fdb.statements = nil
+	failures = 3
+	var id int
+	err := db.QueryRowx("select id from a").Scan(&id)
+	require.True(t, errors.Is(err, ErrConnection))
+	require.Len(t, fdb.log(), 3)
+
+	// doesn't retry writes, unless asked to
+	fdb.statements = nil
+	failures = 1
+	_, err = db.Exec("update a set b = 1")
+	require.True(t, errors.Is(err, ErrConnection))
+	require.Len(t, fdb.log(), 1)
+
+	fdb.statements = nil
+	failures = 1
+	_, err = db.ExecContext(WithRetry(context.Background()), "update a set b = 1")
+	require.NoError(t, err)
+	require.Len(t, fdb.log(), 2)
+
+	// doesn't retry writes run by a read method
+	fdb.statements = nil
+	failures = 1
+	_, err = db.Queryx("insert into a (b) values (1) returning id")
+	require.True(t, errors.Is(err, ErrConnection))
+	require.Len(t, fdb.log(), 1)
+
+	// nor statements that may write behind a Select
+	fdb.statements = nil
+	failures = 1
+	err = db.Select(&ids, "With d As (Delete From a Returning id) Select id From d")
+	require.True(t, errors.Is(err, ErrConnection))
+	require.Len(t, fdb.log(), 1)
+
+	fdb.statements = nil
+	failures = 1
+	ids = nil
+	require.NoError(t, db.SelectContext(WithRetry(context.Background()), &ids, "With d As (Delete From a Returning id) Select id From d"))
+	require.Len(t, fdb.log(), 2)
+
+	// doesn't retry other errors
+	fdb.statements = nil
+	fdb.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+		return nil, &fakePgError{Code: "42601"}
+	}
+	require.Error(t, db.Select(&ids, "select id from a"))
+	require.Len(t, fdb.log(), 1)
+}
+
+func TestTx_RetryStatement(t *testing.T) {
+	db, fdb := newFakeDBX(PostgresDriver)
+	db.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, Retryable: isConnectionLost})
+
+	fdb.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+		return nil, &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}
+	}
+
+	err := db.RunInTx(WithRetry(context.Background()), nil, func(tx *Tx) error {
+		var ids []int
+		return tx.Select(&ids, "select id from a")
+	})
+	require.True(t, errors.Is(err, ErrConnection))
+	require.Equal(t, []string{"BEGIN", "select id from a", "ROLLBACK"}, fdb.log())
+}
+
+func TestDBX_RunInTx(t *testing.T) {
+	db, fdb := newFakeDBX(PostgresDriver)
+	db.SetTxRetryPolicy(RetryPolicy{MaxAttempts: 3, Retryable: isTxConflict})
+
+	logs := &bytes.Buffer{}
+	db.SetLogger(LogError, logs)
+
+	// commits on success
+	err := db.RunInTx(context.Background(), nil, func(tx *Tx) error {
+		_, err := tx.Exec("update a set b = 1")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"BEGIN", "update a set b = 1", "COMMIT"}, fdb.log())
+
+	// rolls back on error without retrying
+	fdb.statements = nil
+	err = db.RunInTx(context.Background(), nil, func(tx *Tx) error {
+		return errors.New("boom")
+	})
+	require.EqualError(t, err, "boom")
+	require.Equal(t, []string{"BEGIN", "ROLLBACK"}, fdb.log())
+
+	// retries serialization failures
+	fdb.statements = nil
+	calls := 0
+	fdb.exec = func(query string, args []driver.NamedValue) (driver.Result, error) {
+		calls++
+		if calls < 3 {
+			return nil, &fakePgError{Code: "40001"}
+		}
+		return driver.RowsAffected(1), nil
+	}
+	err = db.RunInTx(context.Background(), nil, func(tx *Tx) error {
+		_, err := tx.Exec("update a set b = 1")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+	require.Contains(t, logs.String(), LevelTxRetry)
+
+	// rolls back and re-panics
+	fdb.statements = nil
+	fdb.exec = nil
+	require.Panics(t, func() {
+		db.RunInTx(context.Background(), nil, func(tx *Tx) error {
+			panic("boom")
+		})
+	})
+	require.Equal(t, []string{"BEGIN", "ROLLBACK"}, fdb.log())
+}
@@ -0,0 +1,132 @@
+package dbx
+
+import (
+	"context"
+	"sync"
+)
+
+// Span attribute keys, following the OpenTelemetry database semantic conventions
+const (
+	AttrDBSystem     = "db.system"
+	AttrDBStatement  = "db.statement"
+	AttrRowsAffected = "db.rows_affected"
+	AttrTxOutcome    = "dbx.tx.outcome"
+)
+
+// Tracer starts spans. It mirrors the part of the OpenTelemetry trace API dbx needs, so that an SDK
+// tracer can be plugged in with a thin adapter. The returned context must carry the new span so
+// spans started from it become its children.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation: a statement, or a transaction wrapping statements
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+// SetTracer traces every statement run through dbx, and every transaction started afterwards
+// along with the statements it runs
+func (dbx *DBX) SetTracer(tracer Tracer) {
+	dbx.tracer = tracer
+}
+
+// dbSystem maps a driver name to its db.system attribute value
+func dbSystem(driver string) string {
+	switch driver {
+	case PgxDriver, PostgresDriver:
+		return "postgresql"
+	case Sqlite3Driver:
+		return "sqlite"
+	}
+
+	return driver
+}
+
+// SpanRecorder is an in-memory Tracer recording the span tree, meant for asserting on spans in tests
+type SpanRecorder struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+// RecordedSpan is a span captured by a SpanRecorder
+type RecordedSpan struct {
+	Name       string
+	Attributes map[string]interface{}
+	Errors     []error
+	Ended      bool
+	Parent     *RecordedSpan
+	Children   []*RecordedSpan
+
+	recorder *SpanRecorder
+}
+
+type recordedSpanKey struct{}
+
+func NewSpanRecorder() *SpanRecorder {
+	return &SpanRecorder{}
+}
+
+func (r *SpanRecorder) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &RecordedSpan{Name: name, Attributes: map[string]interface{}{}, recorder: r}
+
+	r.mu.Lock()
+	if parent, ok := ctx.Value(recordedSpanKey{}).(*RecordedSpan); ok && parent.recorder == r {
+		span.Parent = parent
+		parent.Children = append(parent.Children, span)
+	}
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+
+	return context.WithValue(ctx, recordedSpanKey{}, span), span
+}
+
+// Spans returns every recorded span in the order they were started
+func (r *SpanRecorder) Spans() []*RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]*RecordedSpan(nil), r.spans...)
+}
+
+// Roots returns the recorded spans that have no parent
+func (r *SpanRecorder) Roots() []*RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var roots []*RecordedSpan
+	for _, s := range r.spans {
+		if s.Parent == nil {
+			roots = append(roots, s)
+		}
+	}
+
+	return roots
+}
+
+// Reset forgets every recorded span
+func (r *SpanRecorder) Reset() {
+	r.mu.Lock()
+	r.spans = nil
+	r.mu.Unlock()
+}
+
+func (s *RecordedSpan) SetAttribute(key string, value interface{}) {
+	s.recorder.mu.Lock()
+	s.Attributes[key] = value
+	s.recorder.mu.Unlock()
+}
+
+func (s *RecordedSpan) RecordError(err error) {
+	s.recorder.mu.Lock()
+	s.Errors = append(s.Errors, err)
+	s.recorder.mu.Unlock()
+}
+
+func (s *RecordedSpan) End() {
+	s.recorder.mu.Lock()
+	s.Ended = true
+	s.recorder.mu.Unlock()
+}
@@ -0,0 +1,114 @@
+package dbx
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracing(t *testing.T) {
+	db, _ := newFakeDBX(PgxDriver)
+	rec := NewSpanRecorder()
+	db.SetTracer(rec)
+
+	_, err := db.Exec("update a   set b = ? -- bump\nwhere c = ?", 1, 2)
+	require.NoError(t, err)
+
+	err = db.RunInTx(context.Background(), nil, func(tx *Tx) error {
+		if _, err := tx.Exec("insert into a values (?)", 1); err != nil {
+			return err
+		}
+
+		return tx.Select(&[]int{}, "select b from a")
+	})
+	require.NoError(t, err)
+
+	roots := rec.Roots()
+	require.Len(t, roots, 2)
+
+	update := roots[0]
+	require.Equal(t, "UPDATE", update.Name)
+	require.True(t, update.Ended)
+	require.Equal(t, "postgresql", update.Attributes[AttrDBSystem])
+	require.Equal(t, "update a set b = $1 where c = $2", update.Attributes[AttrDBStatement])
+	require.EqualValues(t, 1, update.Attributes[AttrRowsAffected])
+
+	tx := roots[1]
+	require.Equal(t, "TRANSACTION", tx.Name)
+	require.True(t, tx.Ended)
+	require.Equal(t, "commit", tx.Attributes[AttrTxOutcome])
+	require.Len(t, tx.Children, 2)
+	require.Equal(t, "INSERT", tx.Children[0].Name)
+	require.Equal(t, "SELECT", tx.Children[1].Name)
+	require.NotContains(t, tx.Children[1].Attributes, AttrRowsAffected)
+}
+
+func TestTracing_Error(t *testing.T) {
+	db, fdb := newFakeDBX(MysqlDriver)
+	rec := NewSpanRecorder()
+	db.SetTracer(rec)
+
+	boom := errors.New("boom")
+	fdb.query = func(query string, args []driver.NamedValue) (driver.Rows, error) {
+		return nil, boom
+	}
+
+	tx := db.MustBegin()
+	require.Error(t, tx.Select(&[]int{}, "select 1"))
+	require.NoError(t, tx.Rollback())
+
+	spans := rec.Spans()
+	require.Len(t, spans, 2)
+	require.Equal(t, "rollback", spans[0].Attributes[AttrTxOutcome])
+	require.Equal(t, "mysql", spans[1].Attributes[AttrDBSystem])
+	require.Equal(t, []error{boom}, spans[1].Errors)
+	require.Equal(t, spans[0], spans[1].Parent)
+}
+
+func TestTracing_UnsafeTx(t *testing.T) {
+	db, _ := newFakeDBX(PgxDriver)
+	rec := NewSpanRecorder()
+	tracer := &endCountingTracer{Tracer: rec, ends: map[string]int{}}
+	db.SetTracer(tracer)
+
+	tx := db.MustBegin()
+	unsafe := tx.Unsafe()
+	require.NoError(t, unsafe.Select(&[]int{}, "select b from a"))
+	require.NoError(t, unsafe.Commit())
+
+	// the original Tx doesn't end the span again, nor overwrite its outcome
+	require.Error(t, tx.Rollback())
+
+	roots := rec.Roots()
+	require.Len(t, roots, 1)
+	require.Equal(t, "TRANSACTION", roots[0].Name)
+	require.True(t, roots[0].Ended)
+	require.Equal(t, "commit", roots[0].Attributes[AttrTxOutcome])
+	require.Empty(t, roots[0].Errors)
+	require.Len(t, roots[0].Children, 1)
+	require.Equal(t, 1, tracer.ends["TRANSACTION"])
+}
+
+// endCountingTracer counts how many times the spans of each name are ended
+type endCountingTracer struct {
+	Tracer
+	ends map[string]int
+}
+
+func (t *endCountingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	ctx, span := t.Tracer.Start(ctx, name)
+	return ctx, &endCountingSpan{Span: span, end: func() { t.ends[name]++ }}
+}
+
+type endCountingSpan struct {
+	Span
+	end func()
+}
+
+func (s *endCountingSpan) End() {
+	s.end()
+	s.Span.End()
+}
@@ -1,41 +1,63 @@
 package dbx
 
 import (
+	"context"
 	"database/sql"
 
 	"time"
 
-	"log"
+	"fmt"
+	"regexp"
+	"sync"
 
 	"github.com/jmoiron/sqlx"
-	"github.com/pkg/errors"
 )
 
+var regSavepointName = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+
 type Tx struct {
-	tx *sqlx.Tx
+	tx     *sqlx.Tx
+	driver string
+	span   *txSpan
+
+	loggers
+	skipLog bool
+	observers
+	server *serverInfo
 
-	errorLog   *log.Logger
-	debugLog   *log.Logger
-	slowLog    *log.Logger
-	slowLogMin time.Duration
-	logAsync   bool
-	skipLog    bool
+	savepointSeq int
 }
 
 func (tx *Tx) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
-	return queryX(tx, query, args...)
+	return queryX(context.Background(), tx, query, args...)
+}
+
+func (tx *Tx) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return queryX(ctx, tx, query, args...)
 }
 
 func (tx *Tx) QueryRowx(query string, args ...interface{}) *sqlx.Row {
-	return queryRowx(tx, query, args...)
+	return queryRowx(context.Background(), tx, query, args...)
+}
+
+func (tx *Tx) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	return queryRowx(ctx, tx, query, args...)
 }
 
 func (tx *Tx) Select(dest interface{}, query string, args ...interface{}) error {
-	return selectX(tx, dest, query, args...)
+	return selectX(context.Background(), tx, dest, query, args...)
+}
+
+func (tx *Tx) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return selectX(ctx, tx, dest, query, args...)
 }
 
 func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
-	return exec(tx, query, args...)
+	return exec(context.Background(), tx, query, args...)
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return exec(ctx, tx, query, args...)
 }
 
 func (tx *Tx) Rebind(query string) string {
@@ -43,16 +65,106 @@ func (tx *Tx) Rebind(query string) string {
 }
 
 func (tx *Tx) Rollback() error {
-	return tx.tx.Rollback()
+	err := ClassifyError(tx.tx.Rollback())
+	tx.endSpan("rollback", err)
+
+	return err
 }
 
 func (tx *Tx) Commit() error {
-	return tx.tx.Commit()
+	err := ClassifyError(tx.tx.Commit())
+	tx.endSpan("commit", err)
+
+	return err
+}
+
+func (tx *Tx) endSpan(outcome string, err error) {
+	if tx.span == nil {
+		return
+	}
+
+	tx.span.end(outcome, err)
+}
+
+// txSpan is the span of a transaction. The Unsafe copies of a Tx share it, the first
+// to commit or roll back ends it.
+type txSpan struct {
+	mu   sync.Mutex
+	span Span
+}
+
+func (s *txSpan) end(outcome string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.span == nil {
+		return
+	}
+
+	s.span.SetAttribute(AttrTxOutcome, outcome)
+	if err != nil {
+		s.span.RecordError(err)
+	}
+
+	s.span.End()
+	s.span = nil
+}
+
+// Savepoint marks the current state of the transaction under the given name
+func (tx *Tx) Savepoint(name string) error {
+	return tx.savepointExec("Savepoint %s", name)
+}
+
+// RollbackTo undoes everything done since the named savepoint, leaving the transaction usable
+func (tx *Tx) RollbackTo(name string) error {
+	return tx.savepointExec("Rollback To Savepoint %s", name)
+}
+
+// Release forgets the named savepoint, keeping the changes made since it was created
+func (tx *Tx) Release(name string) error {
+	return tx.savepointExec("Release Savepoint %s", name)
+}
+
+// Nested runs fn as a unit of work inside a savepoint. If fn returns an error or panics, only the
+// changes made by fn are rolled back and the outer transaction can carry on.
+func (tx *Tx) Nested(fn func(*Tx) error) error {
+	tx.savepointSeq++
+	name := fmt.Sprintf("dbx_sp_%d", tx.savepointSeq)
+
+	if err := tx.Savepoint(name); err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.RollbackTo(name)
+			tx.Release(name)
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.RollbackTo(name); rbErr == nil {
+			tx.Release(name)
+		}
+		return err
+	}
+
+	return tx.Release(name)
+}
+
+func (tx *Tx) savepointExec(stmt string, name string) error {
+	if !regSavepointName.MatchString(name) {
+		return fmt.Errorf("invalid savepoint name '%s'", name)
+	}
+
+	_, err := tx.Exec(fmt.Sprintf(stmt, name))
+	return err
 }
 
 func (tx *Tx) Unsafe() *Tx {
 	unsafe := tx.tx.Unsafe()
-	return &Tx{tx: unsafe, errorLog: tx.errorLog, debugLog: tx.debugLog, slowLog: tx.slowLog, slowLogMin: tx.slowLogMin, logAsync: tx.logAsync}
+	return &Tx{tx: unsafe, driver: tx.driver, span: tx.span, loggers: tx.loggers, observers: tx.observers, server: tx.server}
 }
 
 func (tx *Tx) SkipLog() {
@@ -69,49 +181,47 @@ func (tx *Tx) NamedSelect(dest interface{}, query string, arg interface{}) error
 }
 
 func (tx *Tx) NamedExec(query string, arg interface{}) (sql.Result, error) {
-	return namedExec(tx, query, arg)
+	return namedExec(context.Background(), tx, query, arg)
+}
+
+func (tx *Tx) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	return namedExec(ctx, tx, query, arg)
 }
 
 func (tx *Tx) NamedInsert(target interface{}, tableName string, paramNames []string, m map[string]interface{}) (string, []interface{}, error) {
 	return namedInsert(target, tableName, paramNames, m)
 }
 
-func (tx *Tx) getDB() Querier {
+func (tx *Tx) getDB() sqlxQuerier {
 	return tx.tx
 }
 
-func (tx *Tx) logQuery(query string, execTime time.Duration, err error, args ...interface{}) error {
-	if tx.logAsync == true {
-		go tx.log(query, execTime, err, args...)
-		return nil
-	}
+func (tx *Tx) getObservers() observers {
+	return tx.observers
+}
 
-	return tx.log(query, execTime, err, args...)
+func (tx *Tx) getServer() *serverInfo {
+	return tx.server
 }
 
-func (tx *Tx) log(query string, execTime time.Duration, err error, args ...interface{}) error {
-	if tx.skipLog == true {
-		tx.skipLog = false
-		return nil
-	}
+func (tx *Tx) driverName() string {
+	return tx.driver
+}
 
-	if err != nil && tx.errorLog != nil {
-		if err2 := logMsg(tx.errorLog, LevelError, query, execTime, errors.WithStack(err)); err2 != nil {
-			return err2
-		}
-	}
+func (tx *Tx) inTx() bool {
+	return true
+}
 
-	if execTime >= tx.slowLogMin && tx.slowLog != nil {
-		if err3 := logMsg(tx.slowLog, LevelSlowQuery, query, execTime, nil, args...); err3 != nil {
-			return err3
-		}
-	}
+// retryPolicy never retries, the statements of a transaction can't run again on another connection
+func (tx *Tx) retryPolicy() RetryPolicy {
+	return RetryPolicy{}
+}
 
-	if tx.debugLog != nil {
-		if err4 := logMsg(tx.debugLog, LevelDebug, query, execTime, nil, args...); err4 != nil {
-			return err4
-		}
+func (tx *Tx) logQuery(query string, execTime time.Duration, err error, args ...interface{}) error {
+	if tx.skipLog == true {
+		tx.skipLog = false
+		return nil
 	}
 
-	return nil
+	return tx.loggers.logQuery(query, execTime, err, true, args...)
 }
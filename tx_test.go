@@ -0,0 +1,50 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTx_Nested(t *testing.T) {
+	db, fdb := newFakeDBX(PostgresDriver)
+
+	err := db.RunInTx(context.Background(), nil, func(tx *Tx) error {
+		err := tx.Nested(func(tx *Tx) error {
+			tx.Exec("insert into a values (1)")
+			return errors.New("inner failure")
+		})
+		require.EqualError(t, err, "inner failure")
+
+		return tx.Nested(func(tx *Tx) error {
+			_, err := tx.Exec("insert into a values (2)")
+			return err
+		})
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"BEGIN",
+		"Savepoint dbx_sp_1",
+		"insert into a values (1)",
+		"Rollback To Savepoint dbx_sp_1",
+		"Release Savepoint dbx_sp_1",
+		"Savepoint dbx_sp_2",
+		"insert into a values (2)",
+		"Release Savepoint dbx_sp_2",
+		"COMMIT",
+	}, fdb.log())
+}
+
+func TestTx_Savepoint_InvalidName(t *testing.T) {
+	db, fdb := newFakeDBX(PostgresDriver)
+
+	tx := db.MustBegin()
+	require.Error(t, tx.Savepoint("sp; drop table a"))
+	require.Error(t, tx.RollbackTo(""))
+	require.NoError(t, tx.Rollback())
+
+	require.Equal(t, []string{"BEGIN", "ROLLBACK"}, fdb.log())
+}
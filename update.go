@@ -0,0 +1,227 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// NamedUpdate generates the query and arguments updating the setColumns of the rows matching the
+// whereColumns of target. target can be a struct, a ptr to a struct, or a slice of either, in which case
+// every struct is updated by a single statement, use UpdateStructs for slices over the driver's bind
+// parameter limit.
+// Values are resolved like in NamedInsert: from overrides first, then by field name, then by db tag.
+func (dbx *DBX) NamedUpdate(target interface{}, tableName string, setColumns []string, whereColumns []string, overrides map[string]interface{}) (string, []interface{}, error) {
+	return namedUpdate(dbx.driver, target, tableName, setColumns, whereColumns, overrides)
+}
+
+// UpdateStructs runs the update generated by NamedUpdate. Slices too large for the driver's bind parameter
+// limit are updated in batches, like in InsertStructs, and the returned result adds up their rows.
+func (dbx *DBX) UpdateStructs(ctx context.Context, tableName string, target interface{}, setColumns []string, whereColumns []string, overrides map[string]interface{}) (sql.Result, error) {
+	return updateStructs(ctx, dbx, tableName, target, setColumns, whereColumns, overrides)
+}
+
+func (tx *Tx) NamedUpdate(target interface{}, tableName string, setColumns []string, whereColumns []string, overrides map[string]interface{}) (string, []interface{}, error) {
+	return namedUpdate(tx.driver, target, tableName, setColumns, whereColumns, overrides)
+}
+
+func (tx *Tx) UpdateStructs(ctx context.Context, tableName string, target interface{}, setColumns []string, whereColumns []string, overrides map[string]interface{}) (sql.Result, error) {
+	return updateStructs(ctx, tx, tableName, target, setColumns, whereColumns, overrides)
+}
+
+func updateStructs(ctx context.Context, querier dbxInternal, tableName string, target interface{}, setColumns []string, whereColumns []string, overrides map[string]interface{}) (sql.Result, error) {
+	driver := querier.driverName()
+	batches := splitInsertTarget(target, rowsPerBatch(driver, updateParamsPerRow(driver, setColumns, whereColumns), 0))
+
+	if len(batches) == 1 {
+		query, args, err := namedUpdate(driver, target, tableName, setColumns, whereColumns, copyValueMapper(overrides))
+		if err != nil {
+			return nil, err
+		}
+
+		return exec(ctx, querier, query, args...)
+	}
+
+	total := &bulkResult{}
+	for _, batch := range batches {
+		query, args, err := namedUpdate(driver, batch, tableName, setColumns, whereColumns, copyValueMapper(overrides))
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := exec(ctx, querier, query, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := total.add(res); err != nil {
+			return nil, err
+		}
+	}
+
+	return total, nil
+}
+
+// updateParamsPerRow returns the number of bind parameters the update of a row takes
+func updateParamsPerRow(driver string, setColumns []string, whereColumns []string) int {
+	if driver == MysqlDriver || driver == Sqlite3Driver {
+		// every Case repeats the condition of the row, and so does the Where clause
+		return len(setColumns)*(len(whereColumns)+1) + len(whereColumns)
+	}
+
+	return len(setColumns) + len(excludeColumns(whereColumns, setColumns))
+}
+
+func namedUpdate(driver string, target interface{}, tableName string, setColumns []string, whereColumns []string, valueMapper map[string]interface{}) (string, []interface{}, error) {
+	if len(setColumns) == 0 {
+		return "", nil, &MissingParamErr{"no column to update"}
+	}
+
+	if len(whereColumns) == 0 {
+		return "", nil, &MissingParamErr{"no column to match rows on"}
+	}
+
+	if valueMapper == nil {
+		valueMapper = map[string]interface{}{}
+	}
+
+	items, err := updateItems(target)
+	if err != nil {
+		return "", nil, err
+	}
+
+	columns := append(append([]string{}, setColumns...), excludeColumns(whereColumns, setColumns)...)
+
+	var valuesPart strings.Builder
+	for i, item := range items {
+		values, err := structParamValues(item.Interface(), columns, valueMapper)
+		if err != nil {
+			return "", nil, err
+		}
+
+		valuesPart.WriteString(BuildInsertParams(valueMapper, i, columns, values))
+	}
+
+	var q string
+	switch {
+	case len(items) == 1:
+		q = buildUpdateSingle(tableName, setColumns, whereColumns)
+	case driver == PgxDriver || driver == PostgresDriver:
+		q = buildUpdateFromValues(tableName, setColumns, whereColumns, columns, valuesPart.String())
+	case driver == MysqlDriver || driver == Sqlite3Driver:
+		q = buildUpdateCase(tableName, setColumns, whereColumns, len(items))
+	default:
+		return "", nil, fmt.Errorf("driver %s not supported", driver)
+	}
+
+	return sqlx.Named(q, valueMapper)
+}
+
+// buildUpdateSingle returns the update of a single row. eg. Update t Set a = :a_0 Where id = :id_0
+func buildUpdateSingle(tableName string, setColumns []string, whereColumns []string) string {
+	set := make([]string, len(setColumns))
+	for i, c := range setColumns {
+		set[i] = c + " = " + rowParam(c, 0)
+	}
+
+	return fmt.Sprintf("Update %s Set %s Where %s", tableName, strings.Join(set, ", "), rowCondition(whereColumns, 0))
+}
+
+// buildUpdateFromValues returns a postgres update joining the table with the list of new values.
+// The values are unioned with an empty select of the same columns so postgres types them like the table.
+func buildUpdateFromValues(tableName string, setColumns []string, whereColumns []string, columns []string, valuesPart string) string {
+	const alias = "dbx_v"
+
+	set := make([]string, len(setColumns))
+	for i, c := range setColumns {
+		set[i] = c + " = " + alias + "." + c
+	}
+
+	where := make([]string, len(whereColumns))
+	for i, c := range whereColumns {
+		where[i] = tableName + "." + c + " = " + alias + "." + c
+	}
+
+	cols := strings.Join(columns, ",")
+
+	return fmt.Sprintf("Update %s Set %s From ((Select %s From %s Limit 0) Union All Values %s) As %s (%s) Where %s",
+		tableName, strings.Join(set, ", "), cols, tableName, valuesPart, alias, cols, strings.Join(where, " And "))
+}
+
+// buildUpdateCase returns an update picking each new value with a Case on the row, for mysql and sqlite
+func buildUpdateCase(tableName string, setColumns []string, whereColumns []string, numRows int) string {
+	set := make([]string, len(setColumns))
+	for i, c := range setColumns {
+		set[i] = c + " = Case"
+		for row := 0; row < numRows; row++ {
+			set[i] += " When " + rowCondition(whereColumns, row) + " Then " + rowParam(c, row)
+		}
+		set[i] += " Else " + c + " End"
+	}
+
+	where := make([]string, numRows)
+	for row := range where {
+		where[row] = "(" + rowCondition(whereColumns, row) + ")"
+	}
+
+	return fmt.Sprintf("Update %s Set %s Where %s", tableName, strings.Join(set, ", "), strings.Join(where, " Or "))
+}
+
+// rowCondition matches the columns of a row with their params. eg. id = :id_0 And tenant = :tenant_0
+func rowCondition(columns []string, row int) string {
+	conds := make([]string, len(columns))
+	for i, c := range columns {
+		conds[i] = c + " = " + rowParam(c, row)
+	}
+
+	return strings.Join(conds, " And ")
+}
+
+func rowParam(column string, row int) string {
+	return ":" + column + "_" + strconv.Itoa(row)
+}
+
+// updateItems returns the structs of target, which can be a struct, a slice, or pointers to either
+func updateItems(target interface{}) ([]reflect.Value, error) {
+	value := reflect.ValueOf(target)
+
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil, &NilPointerErr{"nil pointer passed to namedUpdate target"}
+		}
+
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		return []reflect.Value{value}, nil
+	case reflect.Slice:
+		if value.Len() == 0 {
+			return nil, &EmptySliceErr{"target slice is empty"}
+		}
+
+		items := make([]reflect.Value, value.Len())
+		for i := range items {
+			item := value.Index(i)
+			if item.Kind() == reflect.Ptr {
+				if item.IsNil() {
+					return nil, &NilPointerErr{"nil pointer passed to namedUpdate target"}
+				}
+
+				item = item.Elem()
+			}
+
+			items[i] = item
+		}
+
+		return items, nil
+	}
+
+	return nil, &WrongTypeErr{"target type not accepted"}
+}
@@ -0,0 +1,154 @@
+package dbx
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_namedUpdate(t *testing.T) {
+	type person struct {
+		ID     int    `db:"id"`
+		Tenant int    `db:"tenant"`
+		Name   string `db:"name"`
+		Age    int    `db:"age"`
+	}
+
+	people := []*person{{ID: 1, Tenant: 9, Name: "Alpha", Age: 20}, {ID: 2, Tenant: 9, Name: "Beta", Age: 30}}
+
+	cases := []struct {
+		testName      string
+		driver        string
+		target        interface{}
+		set           []string
+		where         []string
+		mapValues     map[string]interface{}
+		expectedQuery string
+		expectedArgs  []interface{}
+		expectedErr   error
+	}{
+		{
+			testName:      "Single struct",
+			driver:        PostgresDriver,
+			target:        people[0],
+			set:           []string{"name", "Age"},
+			where:         []string{"id"},
+			expectedQuery: "Update person Set name = ?, Age = ? Where id = ?",
+			expectedArgs:  []interface{}{"Alpha", 20, 1},
+		},
+		{
+			testName:      "Single struct with override",
+			driver:        MysqlDriver,
+			target:        *people[0],
+			set:           []string{"name"},
+			where:         []string{"id", "tenant"},
+			mapValues:     map[string]interface{}{"name": "Omega"},
+			expectedQuery: "Update person Set name = ? Where id = ? And tenant = ?",
+			expectedArgs:  []interface{}{"Omega", 1, 9},
+		},
+		{
+			testName: "Postgres slice",
+			driver:   PgxDriver,
+			target:   people,
+			set:      []string{"name", "age"},
+			where:    []string{"id"},
+			expectedQuery: "Update person Set name = dbx_v.name, age = dbx_v.age " +
+				"From ((Select name,age,id From person Limit 0) Union All Values (?,?,?),(?,?,?)) As dbx_v (name,age,id) " +
+				"Where person.id = dbx_v.id",
+			expectedArgs: []interface{}{"Alpha", 20, 1, "Beta", 30, 2},
+		},
+		{
+			testName: "Mysql slice",
+			driver:   MysqlDriver,
+			target:   people,
+			set:      []string{"name"},
+			where:    []string{"id", "tenant"},
+			expectedQuery: "Update person Set name = Case When id = ? And tenant = ? Then ? When id = ? And tenant = ? Then ? Else name End " +
+				"Where (id = ? And tenant = ?) Or (id = ? And tenant = ?)",
+			expectedArgs: []interface{}{1, 9, "Alpha", 2, 9, "Beta", 1, 9, 2, 9},
+		},
+		{
+			testName:    "Unknown column",
+			driver:      Sqlite3Driver,
+			target:      people,
+			set:         []string{"unknown"},
+			where:       []string{"id"},
+			expectedErr: &MissingParamErr{"param 'unknown' not found"},
+		},
+		{
+			testName:    "No where column",
+			driver:      Sqlite3Driver,
+			target:      people,
+			set:         []string{"name"},
+			expectedErr: &MissingParamErr{"no column to match rows on"},
+		},
+		{
+			testName:    "Empty slice",
+			driver:      Sqlite3Driver,
+			target:      []person{},
+			set:         []string{"name"},
+			where:       []string{"id"},
+			expectedErr: &EmptySliceErr{"target slice is empty"},
+		},
+	}
+
+	for _, c := range cases {
+		query, args, err := namedUpdate(c.driver, c.target, "person", c.set, c.where, c.mapValues)
+		if c.expectedErr != nil {
+			require.EqualValues(t, c.expectedErr, err, c.testName)
+			continue
+		}
+
+		require.NoError(t, err, c.testName)
+		require.Equal(t, c.expectedQuery, query, c.testName)
+		require.EqualValues(t, c.expectedArgs, args, c.testName)
+	}
+}
+
+func Test_updateParamsPerRow(t *testing.T) {
+	type person struct {
+		ID     int    `db:"id"`
+		Tenant int    `db:"tenant"`
+		Name   string `db:"name"`
+	}
+
+	people := []person{{ID: 1, Tenant: 9, Name: "Alpha"}, {ID: 2, Tenant: 9, Name: "Beta"}}
+
+	for _, driver := range []string{PostgresDriver, MysqlDriver, Sqlite3Driver} {
+		for _, where := range [][]string{{"id"}, {"id", "tenant"}, {"id", "name"}} {
+			_, args, err := namedUpdate(driver, people, "person", []string{"name", "tenant"}, where, nil)
+			require.NoError(t, err)
+
+			require.Equal(t, len(args)/len(people), updateParamsPerRow(driver, []string{"name", "tenant"}, where), driver, where)
+		}
+	}
+}
+
+func TestDBX_UpdateStructs_Batches(t *testing.T) {
+	type person struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+
+	dbx, fdb := newFakeDBX(PostgresDriver)
+
+	// 2 params per row, 32767 rows fit under the postgres limit
+	people := make([]person, 65535/2+2)
+	for i := range people {
+		people[i] = person{ID: i, Name: "name"}
+	}
+
+	res, err := dbx.UpdateStructs(context.Background(), "person", people, []string{"name"}, []string{"id"}, nil)
+	require.NoError(t, err)
+
+	affected, err := res.RowsAffected()
+	require.NoError(t, err)
+	require.EqualValues(t, 2, affected)
+
+	log := fdb.log()
+	require.Len(t, log, 2)
+	require.Equal(t, 65535/2*2, strings.Count(log[0], "$"))
+	require.Equal(t, "Update person Set name = dbx_v.name From ((Select name,id From person Limit 0) Union All Values ($1,$2),($3,$4)) As dbx_v (name,id) Where person.id = dbx_v.id", log[1])
+}
@@ -0,0 +1,123 @@
+package dbx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Upsert describes what an insert does with rows conflicting with existing ones
+type Upsert struct {
+	// ConflictColumns is the conflict target: the columns of a unique index or primary key.
+	// It is required by postgres and sqlite to update, and ignored by mysql which checks every unique key.
+	ConflictColumns []string
+
+	// UpdateColumns are overwritten with the inserted values. When empty, every inserted column
+	// except the conflict columns is updated.
+	UpdateColumns []string
+
+	// DoNothing keeps the existing rows untouched
+	DoNothing bool
+}
+
+// NamedUpsert generates an insert query like NamedInsert, followed by the clause resolving conflicts
+// for the driver of dbx
+func (dbx *DBX) NamedUpsert(target interface{}, tableName string, paramNames []string, m map[string]interface{}, upsert Upsert) (string, []interface{}, error) {
+	return namedUpsert(dbx.driver, target, tableName, paramNames, m, upsert)
+}
+
+func (tx *Tx) NamedUpsert(target interface{}, tableName string, paramNames []string, m map[string]interface{}, upsert Upsert) (string, []interface{}, error) {
+	return namedUpsert(tx.driver, target, tableName, paramNames, m, upsert)
+}
+
+func namedUpsert(driver string, target interface{}, tableName string, params []string, valueMapper map[string]interface{}, upsert Upsert) (string, []interface{}, error) {
+	if valueMapper == nil {
+		valueMapper = map[string]interface{}{}
+	}
+
+	params, err := insertColumns(target, params)
+	if err != nil {
+		return "", nil, err
+	}
+
+	q, err := buildNamedInsert(target, tableName, params, valueMapper)
+	if err != nil {
+		return "", nil, err
+	}
+
+	clause, err := upsertClause(driver, params, upsert)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return sqlx.Named(q+" "+clause, valueMapper)
+}
+
+// upsertClause returns the conflict clause appended to an insert of params
+func upsertClause(driver string, params []string, upsert Upsert) (string, error) {
+	updateColumns := upsert.UpdateColumns
+	if len(updateColumns) == 0 && !upsert.DoNothing {
+		updateColumns = excludeColumns(params, upsert.ConflictColumns)
+		if len(updateColumns) == 0 {
+			return "", &MissingParamErr{"no column left to update on conflict"}
+		}
+	}
+
+	switch driver {
+	case MysqlDriver:
+		if upsert.DoNothing {
+			// assigning a column to itself leaves the row untouched, unlike Insert Ignore which also hides other errors
+			return fmt.Sprintf("On Duplicate Key Update %s = %s", params[0], params[0]), nil
+		}
+
+		return "On Duplicate Key Update " + assignColumns(updateColumns, "Values(%s)"), nil
+	case PgxDriver, PostgresDriver, Sqlite3Driver:
+		target := ""
+		if len(upsert.ConflictColumns) > 0 {
+			target = "(" + strings.Join(upsert.ConflictColumns, ",") + ") "
+		}
+
+		if upsert.DoNothing {
+			return "On Conflict " + target + "Do Nothing", nil
+		}
+
+		if target == "" {
+			return "", &MissingParamErr{fmt.Sprintf("conflict columns are required to update on conflict with driver %s", driver)}
+		}
+
+		return "On Conflict " + target + "Do Update Set " + assignColumns(updateColumns, "excluded.%s"), nil
+	}
+
+	return "", fmt.Errorf("driver %s not supported", driver)
+}
+
+// assignColumns returns "col = <value>" pairs, value being a format receiving the column name
+func assignColumns(columns []string, value string) string {
+	assignments := make([]string, len(columns))
+	for i, c := range columns {
+		assignments[i] = c + " = " + fmt.Sprintf(value, c)
+	}
+
+	return strings.Join(assignments, ", ")
+}
+
+func excludeColumns(columns []string, excluded []string) []string {
+	var out []string
+
+	for _, c := range columns {
+		skip := false
+		for _, e := range excluded {
+			if c == e {
+				skip = true
+				break
+			}
+		}
+
+		if !skip {
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
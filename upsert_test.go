@@ -0,0 +1,80 @@
+package dbx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_namedUpsert(t *testing.T) {
+	type person struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+		Age  int    `db:"age"`
+	}
+
+	data := []person{{ID: 1, Name: "Alpha", Age: 20}, {ID: 2, Name: "Beta", Age: 30}}
+
+	cases := []struct {
+		testName      string
+		driver        string
+		upsert        Upsert
+		expectedQuery string
+		expectedErr   error
+	}{
+		{
+			testName:      "Postgres update listed columns",
+			driver:        PostgresDriver,
+			upsert:        Upsert{ConflictColumns: []string{"id"}, UpdateColumns: []string{"name"}},
+			expectedQuery: "Insert into person (id,name,age) Values (?,?,?),(?,?,?) On Conflict (id) Do Update Set name = excluded.name",
+		},
+		{
+			testName:      "Pgx update every non conflicting column",
+			driver:        PgxDriver,
+			upsert:        Upsert{ConflictColumns: []string{"id"}},
+			expectedQuery: "Insert into person (id,name,age) Values (?,?,?),(?,?,?) On Conflict (id) Do Update Set name = excluded.name, age = excluded.age",
+		},
+		{
+			testName:      "Sqlite do nothing without target",
+			driver:        Sqlite3Driver,
+			upsert:        Upsert{DoNothing: true},
+			expectedQuery: "Insert into person (id,name,age) Values (?,?,?),(?,?,?) On Conflict Do Nothing",
+		},
+		{
+			testName:      "Postgres do nothing with target",
+			driver:        PostgresDriver,
+			upsert:        Upsert{ConflictColumns: []string{"id", "name"}, DoNothing: true},
+			expectedQuery: "Insert into person (id,name,age) Values (?,?,?),(?,?,?) On Conflict (id,name) Do Nothing",
+		},
+		{
+			testName:      "Mysql update",
+			driver:        MysqlDriver,
+			upsert:        Upsert{ConflictColumns: []string{"id"}},
+			expectedQuery: "Insert into person (id,name,age) Values (?,?,?),(?,?,?) On Duplicate Key Update name = Values(name), age = Values(age)",
+		},
+		{
+			testName:      "Mysql do nothing",
+			driver:        MysqlDriver,
+			upsert:        Upsert{DoNothing: true},
+			expectedQuery: "Insert into person (id,name,age) Values (?,?,?),(?,?,?) On Duplicate Key Update id = id",
+		},
+		{
+			testName:    "Postgres update without conflict target",
+			driver:      PostgresDriver,
+			upsert:      Upsert{UpdateColumns: []string{"name"}},
+			expectedErr: &MissingParamErr{"conflict columns are required to update on conflict with driver postgres"},
+		},
+	}
+
+	for _, c := range cases {
+		query, args, err := namedUpsert(c.driver, data, "person", []string{"id", "name", "age"}, nil, c.upsert)
+		if c.expectedErr != nil {
+			require.EqualValues(t, c.expectedErr, err, c.testName)
+			continue
+		}
+
+		require.NoError(t, err, c.testName)
+		require.Equal(t, c.expectedQuery, query, c.testName)
+		require.EqualValues(t, []interface{}{1, "Alpha", 20, 2, "Beta", 30}, args, c.testName)
+	}
+}